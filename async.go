@@ -0,0 +1,219 @@
+package idempo
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ExecutionStatus is the status of an execution accepted with Wrapper.Submit.
+type ExecutionStatus int
+
+const (
+	// StatusPending means the Action has not completed yet.
+	StatusPending ExecutionStatus = iota
+	// StatusSucceeded means the Action has completed successfully.
+	StatusSucceeded
+	// StatusFailed means the Action has failed and its failure output was
+	// persisted.
+	StatusFailed
+)
+
+// Handle refers to an execution accepted with Wrapper.Submit.
+type Handle struct {
+	IdempotencyKey string
+	// Accepted is false if the execution associated with the idempotency key
+	// had already been submitted (or completed) before.
+	Accepted bool
+}
+
+// Execution describes the state of an execution accepted with
+// Wrapper.Submit.
+type Execution[S any] struct {
+	Status ExecutionStatus
+	// SuccessOutput is set if Status is StatusSucceeded.
+	SuccessOutput S
+	// Failure is the error converted from the stored failure output if Status
+	// is StatusFailed.
+	Failure error
+}
+
+// Submit accepts the Action for asynchronous execution and returns
+// immediately, which is useful for long-running Actions (e.g. to back HTTP
+// 202 Accepted responses).
+//
+// It validates and checks idempotencyKey like Wrap does. If there is no
+// Record, it persists an in-progress one and queues the Action to the
+// WorkerPool from the Config. The worker executes it within a UnitOfWork and
+// replaces the in-progress Record with the outcome. Until then Wrap calls with
+// the same key fail with ErrInProgress. Use Status to poll for the outcome.
+//
+// If the execution has already completed, successfully or with a persisted
+// failure, Submit returns a Handle that is not Accepted and no error.
+//
+// If the Action fails with an error that is not persisted, the in-progress
+// Record is deleted, so the execution can be submitted again. No outcome
+// remains in this case, so Status reports ErrIdempotencyRecordNotFound, as
+// if the execution had never been submitted.
+//
+// If the Config defines a Lease, an execution whose lease has expired is taken
+// over (see Lease).
+//
+// Submit requires the Store to implement the FencedStore interface.
+func (w Wrapper[T, I, S, F]) Submit(ctx context.Context, idempotencyKey string,
+	input I,
+	action Action[T, I, S],
+) (handle Handle, err error) {
+	if w.workerPool == nil {
+		err = ErrNoWorkerPool
+		return
+	}
+	key, inputHash, err := w.prepare(ctx, idempotencyKey, input)
+	if err != nil {
+		return
+	}
+	handle.IdempotencyKey = idempotencyKey
+	unlock, err := w.lock(ctx, key)
+	if err != nil {
+		return
+	}
+	var claim Claim
+	err = w.executeUnitOfWork(ctx, func(ctx context.Context,
+		repos T,
+	) (fnErr error) {
+		handle.Accepted = false
+		store := repos.IdempotencyStore()
+		if _, ok := store.(FencedStore); !ok {
+			return ErrStoreNotFenced
+		}
+		ok, _, fnErr := w.storeAdapter.AlreadyProcessed(ctx, key, inputHash, store)
+		if ok {
+			// The execution has completed, fnErr is its replayed failure, if any,
+			// which is reported by Status.
+			return nil
+		}
+		if errors.Is(fnErr, ErrInProgress) {
+			// The execution with an expired lease is taken over.
+			claim, handle.Accepted, fnErr = w.takeOverLease(ctx, store, key)
+			return
+		}
+		if fnErr != nil {
+			return
+		}
+		handle.Accepted = true
+		claim = w.lease.claim(1)
+		return w.storeAdapter.SaveInProgress(ctx, key, inputHash.Value, claim,
+			store)
+	})
+	unlock()
+	if err != nil || !handle.Accepted {
+		return
+	}
+	// The job must outlive the request that submitted it.
+	jobCtx := context.WithoutCancel(ctx)
+	err = w.workerPool.submit(ctx, func() {
+		w.complete(jobCtx, key, inputHash, claim, input, action)
+	})
+	if err != nil {
+		w.release(jobCtx, key, claim)
+	}
+	return
+}
+
+// Status returns the state of the execution submitted with the given
+// idempotency key, or ErrIdempotencyRecordNotFound if there is none, including
+// when the Action has failed with an error that is not persisted.
+func (w Wrapper[T, I, S, F]) Status(ctx context.Context,
+	idempotencyKey string,
+) (execution Execution[S], err error) {
+	if w.keyValidator != nil {
+		if err = w.keyValidator.Validate(idempotencyKey); err != nil {
+			return
+		}
+	}
+	key, err := w.key(ctx, idempotencyKey)
+	if err != nil {
+		return
+	}
+	err = executeContext(ctx, w.unitOfWork, func(ctx context.Context,
+		repos T,
+	) (fnErr error) {
+		record, fnErr := repos.IdempotencyStore().Get(ctx, key.ID())
+		if fnErr != nil {
+			return
+		}
+		switch {
+		case record.Expired(time.Now()):
+			return ErrIdempotencyRecordNotFound
+		case record.InProgress:
+			execution = Execution[S]{Status: StatusPending}
+		case record.SuccessOutput:
+			execution = Execution[S]{Status: StatusSucceeded}
+			execution.SuccessOutput, fnErr = w.storeAdapter.Replay(record)
+		default:
+			execution = Execution[S]{Status: StatusFailed}
+			_, execution.Failure = w.storeAdapter.Replay(record)
+		}
+		return
+	})
+	return
+}
+
+// complete executes the submitted Action and replaces the in-progress Record
+// with its outcome, unless the lease was taken over in the meantime, in which
+// case it returns ErrLeaseLost.
+func (w Wrapper[T, I, S, F]) complete(ctx context.Context, key Key,
+	inputHash InputHash,
+	claim Claim,
+	input I,
+	action Action[T, I, S],
+) (err error) {
+	stop := w.heartbeat(ctx, key, claim)
+	unlock, err := w.lock(ctx, key)
+	if err != nil {
+		stop()
+		w.release(ctx, key, claim)
+		return
+	}
+	err = w.executeUnitOfWork(ctx, func(ctx context.Context,
+		repos T,
+	) (fnErr error) {
+		store := repos.IdempotencyStore()
+		fenced, ok := store.(FencedStore)
+		if !ok {
+			return ErrStoreNotFenced
+		}
+		if fnErr = checkFencingToken(ctx, store, key, claim); fnErr != nil {
+			return
+		}
+		successOutput, actionErr := action(ctx, repos, key.IdempotencyKey, input)
+		// The lease could have been taken over while the Action was executed,
+		// so the outcome replaces the in-progress Record only if it's still
+		// held under the claim.
+		_, fnErr = w.saveOutcome(ctx, claimedStore{fenced, store, claim}, key,
+			inputHash, successOutput, actionErr)
+		return
+	})
+	unlock()
+	stop()
+	if err != nil {
+		w.release(ctx, key, claim)
+	}
+	return
+}
+
+// release deletes the in-progress Record held under the claim, so the
+// execution can be submitted again.
+func (w Wrapper[T, I, S, F]) release(ctx context.Context, key Key,
+	claim Claim,
+) {
+	executeContext(ctx, w.unitOfWork, func(ctx context.Context,
+		repos T,
+	) error {
+		fenced, ok := repos.IdempotencyStore().(FencedStore)
+		if !ok {
+			return ErrStoreNotFenced
+		}
+		return fenced.DeleteFenced(ctx, claim, key.ID())
+	})
+}
@@ -0,0 +1,129 @@
+package idempo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+func TestSubmit(t *testing.T) {
+	var (
+		db   = newDB()
+		pool = idempo.NewWorkerPool(1, 10)
+		conf = newConf(newUnitOfWork(db))
+	)
+	defer pool.Close()
+	conf.WorkerPool = pool
+	var (
+		wrapper = idempo.NewWrapper[repos, transferInput](conf)
+		input   = transferInput{FromAccount: "A", ToAccount: "B", Amount: 500}
+	)
+
+	handle, err := wrapper.Submit(context.TODO(), "transfer-123", input, transfer)
+	assertfatal.EqualError(err, nil, t)
+	assertfatal.Equal(handle.Accepted, true, t)
+
+	t.Run("Should not accept the same transfer twice", func(t *testing.T) {
+		handle, err := wrapper.Submit(context.TODO(), "transfer-123", input,
+			transfer)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(handle.Accepted, false, t)
+	})
+
+	t.Run("Should eventually succeed", func(t *testing.T) {
+		execution := awaitExecution(t, wrapper, "transfer-123")
+		assertfatal.Equal(execution.Status, idempo.StatusSucceeded, t)
+		assertfatal.Equal(isUUID(execution.SuccessOutput.TransactionID), true, t)
+		assertfatal.Equal(getBalance(db, input.FromAccount), 500, t)
+	})
+
+	t.Run("Should fail with insufficient funds", func(t *testing.T) {
+		input := input
+		input.Amount = 1000
+		_, err := wrapper.Submit(context.TODO(), "transfer-456", input, transfer)
+		assertfatal.EqualError(err, nil, t)
+		execution := awaitExecution(t, wrapper, "transfer-456")
+		assertfatal.Equal(execution.Status, idempo.StatusFailed, t)
+		assertfatal.EqualError(execution.Failure, errInsufficientFunds, t)
+	})
+
+	t.Run("Should not accept the failed transfer again", func(t *testing.T) {
+		input := input
+		input.Amount = 1000
+		handle, err := wrapper.Submit(context.TODO(), "transfer-456", input,
+			transfer)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(handle.Accepted, false, t)
+	})
+}
+
+func TestSubmitNotPersistedFailure(t *testing.T) {
+	var (
+		pool = idempo.NewWorkerPool(1, 10)
+		conf = newConf(newUnitOfWork(newDB()))
+	)
+	defer pool.Close()
+	conf.WorkerPool = pool
+	var (
+		wrapper        = idempo.NewWrapper[repos, transferInput](conf)
+		errUnavailable = errors.New("service unavailable")
+		calls          int
+		action         = func(ctx context.Context, repos repos,
+			idempotencyKey string, input transferInput,
+		) (result transferSuccess, err error) {
+			calls++
+			err = errUnavailable
+			return
+		}
+		input = transferInput{FromAccount: "A", ToAccount: "B", Amount: 1}
+	)
+	wait := func() {
+		for range 100 {
+			if _, err := wrapper.Status(context.TODO(), "transfer-123"); errors.Is(err,
+				idempo.ErrIdempotencyRecordNotFound) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	handle, err := wrapper.Submit(context.TODO(), "transfer-123", input, action)
+	assertfatal.EqualError(err, nil, t)
+	assertfatal.Equal(handle.Accepted, true, t)
+	wait()
+
+	t.Run("Status should report ErrIdempotencyRecordNotFound", func(t *testing.T) {
+		_, err := wrapper.Status(context.TODO(), "transfer-123")
+		assertfatal.EqualError(err, idempo.ErrIdempotencyRecordNotFound, t)
+		assertfatal.Equal(calls, 1, t)
+	})
+
+	t.Run("Should accept the transfer again", func(t *testing.T) {
+		handle, err := wrapper.Submit(context.TODO(), "transfer-123", input, action)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(handle.Accepted, true, t)
+		wait()
+		assertfatal.Equal(calls, 2, t)
+	})
+}
+
+// awaitExecution polls the Status of the submitted execution until it's no
+// longer pending.
+func awaitExecution(t *testing.T, wrapper idempo.Wrapper[repos, transferInput,
+	transferSuccess, transferFailure], idempotencyKey string,
+) (execution idempo.Execution[transferSuccess]) {
+	var err error
+	for range 100 {
+		execution, err = wrapper.Status(context.TODO(), idempotencyKey)
+		assertfatal.EqualError(err, nil, t)
+		if execution.Status != idempo.StatusPending {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return
+}
@@ -0,0 +1,266 @@
+package idempo
+
+import (
+	"context"
+	"fmt"
+)
+
+// Item is a single entry of the Wrapper.WrapBatch call.
+type Item[I any] struct {
+	IdempotencyKey string
+	Input          I
+}
+
+// ItemResult is the outcome of a single Item of the Wrapper.WrapBatch call.
+type ItemResult[S any] struct {
+	SuccessOutput S
+	// Err is an invalid key error, ErrHashMismatch, ErrInProgress, a replayed
+	// or persisted Action failure, or an Action error that is not persisted.
+	Err error
+}
+
+// WrapBatch executes the provided Action idempotently for each Item within a
+// single UnitOfWork.
+//
+// Existing Records are retrieved with a single Store.GetMany call, the Action
+// is executed only for Items without a Record, and new Records are persisted
+// with a single Store.SaveMany call (see BatchStore). Items with the same
+// idempotency key are processed in order, so later ones replay the result of
+// the first. In-progress Records with expired leases are taken over, if the
+// Store implements the FencedStore interface.
+//
+// Failures are reported per Item: invalid keys, hash mismatches, in-progress
+// Records, replayed or persisted Action failures, and Action errors that are
+// not persisted (PersistNone). Since the latter can leave partial side
+// effects, the UnitOfWork is rolled back and executed again without the
+// failed Item, so the other Items are committed, and the failed one, together
+// with the later Items with the same idempotency key, gets the error and can
+// be retried separately. So each such failure costs another UnitOfWork.
+//
+// A Store error stops the batch: the whole UnitOfWork is rolled back and the
+// error is returned as err with nil results.
+//
+// If the Config defines a Locker, the locks for all the Items are held while
+// the UnitOfWork is executed (see Locker).
+func (w Wrapper[T, I, S, F]) WrapBatch(ctx context.Context, items []Item[I],
+	action Action[T, I, S],
+) (results []ItemResult[S], err error) {
+	var (
+		keys        = make([]Key, len(items))
+		inputHashes = make([]InputHash, len(items))
+		itemErrs    = make([]error, len(items))
+		ids         = make([]string, 0, len(items))
+	)
+	for i, item := range items {
+		keys[i], inputHashes[i], itemErrs[i] = w.prepare(ctx, item.IdempotencyKey,
+			item.Input)
+		if itemErrs[i] == nil {
+			ids = append(ids, keys[i].ID())
+		}
+	}
+	unlock, err := w.lockAll(ctx, ids)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	for {
+		var failed int
+		results, failed, err = w.executeBatch(ctx, items, keys, inputHashes,
+			itemErrs, ids, action)
+		if failed < 0 {
+			break
+		}
+		// The failed Item and the later Items with the same key are excluded.
+		for i := failed; i < len(items); i++ {
+			if itemErrs[i] == nil && keys[i].ID() == keys[failed].ID() {
+				itemErrs[i] = err
+			}
+		}
+	}
+	if err != nil {
+		results = nil
+	}
+	return
+}
+
+// executeBatch executes the Items without errors within a new UnitOfWork.
+// failed is the index of the Item whose Action error, returned as err, is not
+// persisted, or -1.
+func (w Wrapper[T, I, S, F]) executeBatch(ctx context.Context,
+	items []Item[I],
+	keys []Key,
+	inputHashes []InputHash,
+	itemErrs []error,
+	ids []string,
+	action Action[T, I, S],
+) (results []ItemResult[S], failed int, err error) {
+	// notPersisted is the Action error of the current Item, that is not
+	// persisted.
+	var notPersisted error
+	capture := func(ctx context.Context, repos T, idempotencyKey string,
+		input I,
+	) (successOutput S, err error) {
+		successOutput, err = action(ctx, repos, idempotencyKey, input)
+		if err != nil {
+			if persistence, _ := w.errorToFailure(err); !persistence.Persist() {
+				notPersisted = err
+			}
+		}
+		return
+	}
+	err = w.executeUnitOfWork(ctx, func(ctx context.Context,
+		repos T,
+	) (fnErr error) {
+		results = make([]ItemResult[S], len(items))
+		failed = -1
+		batch, fnErr := newBatchStore(ctx, repos.IdempotencyStore(), ids)
+		if fnErr != nil {
+			return
+		}
+		store := batch.asStore()
+		for i, item := range items {
+			if itemErrs[i] != nil {
+				results[i].Err = itemErrs[i]
+				continue
+			}
+			notPersisted = nil
+			results[i].SuccessOutput, results[i].Err, fnErr = w.execute(ctx, repos,
+				store, keys[i], inputHashes[i], item.Input, capture)
+			if fnErr != nil {
+				if notPersisted != nil {
+					failed = i
+				}
+				return
+			}
+		}
+		return batch.flush(ctx)
+	})
+	if failed >= 0 {
+		err = notPersisted
+	}
+	return
+}
+
+// newBatchStore prefetches Records with the given IDs.
+func newBatchStore(ctx context.Context, store Store, ids []string) (
+	s *batchStore, err error,
+) {
+	s = &batchStore{store: store}
+	if batch, ok := store.(BatchStore); ok {
+		s.records, err = batch.GetMany(ctx, ids)
+		if err != nil {
+			return
+		}
+	} else {
+		s.records = make(map[string]Record, len(ids))
+		for _, id := range ids {
+			record, err := store.Get(ctx, id)
+			if err == ErrIdempotencyRecordNotFound {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			s.records[id] = record
+		}
+	}
+	return
+}
+
+// batchStore serves Get from prefetched Records and buffers saved Records,
+// so they can be persisted with a single SaveMany call.
+type batchStore struct {
+	store   Store
+	records map[string]Record
+	pending []Record
+}
+
+// asStore returns the batchStore as a FencedStore if the underlying Store
+// implements it, so in-progress Records with expired leases can be taken over.
+func (s *batchStore) asStore() Store {
+	if fenced, ok := s.store.(FencedStore); ok {
+		return fencedBatchStore{s, fenced}
+	}
+	return s
+}
+
+func (s *batchStore) Get(ctx context.Context, id string) (record Record,
+	err error,
+) {
+	record, ok := s.records[id]
+	if !ok {
+		err = ErrIdempotencyRecordNotFound
+	}
+	return
+}
+
+func (s *batchStore) Save(ctx context.Context, record Record) error {
+	s.records[record.ID] = record
+	s.pending = append(s.pending, record)
+	return nil
+}
+
+func (s *batchStore) Update(ctx context.Context, record Record) (err error) {
+	if updater, ok := s.store.(Updater); ok {
+		if err = updater.Update(ctx, record); err != nil {
+			return
+		}
+	}
+	s.records[record.ID] = record
+	return
+}
+
+func (s *batchStore) Delete(ctx context.Context, id string) (err error) {
+	if deleter, ok := s.store.(Deleter); ok {
+		if err = deleter.Delete(ctx, id); err != nil {
+			return
+		}
+	}
+	delete(s.records, id)
+	return
+}
+
+func (s *batchStore) flush(ctx context.Context) (err error) {
+	if len(s.pending) == 0 {
+		return
+	}
+	if batch, ok := s.store.(BatchStore); ok {
+		err = batch.SaveMany(ctx, s.pending)
+	} else {
+		for _, record := range s.pending {
+			if err = s.store.Save(ctx, record); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf(ErrorPrefix+"failed to save batch records: %w", err)
+	}
+	return
+}
+
+// fencedBatchStore is the batchStore of a FencedStore.
+type fencedBatchStore struct {
+	*batchStore
+	fenced FencedStore
+}
+
+func (s fencedBatchStore) UpdateFenced(ctx context.Context, claim Claim,
+	record Record,
+) (err error) {
+	if err = s.fenced.UpdateFenced(ctx, claim, record); err != nil {
+		return
+	}
+	s.records[record.ID] = record
+	return
+}
+
+func (s fencedBatchStore) DeleteFenced(ctx context.Context, claim Claim,
+	id string,
+) (err error) {
+	if err = s.fenced.DeleteFenced(ctx, claim, id); err != nil {
+		return
+	}
+	delete(s.records, id)
+	return
+}
@@ -0,0 +1,179 @@
+package idempo_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+func TestWrapBatch(t *testing.T) {
+	var (
+		db      = newDB()
+		wrapper = idempo.NewWrapper[repos, transferInput](
+			newConf(newUnitOfWork(db)))
+	)
+	_, err := wrapper.Wrap(context.TODO(), "transfer-1",
+		transferInput{FromAccount: "A", ToAccount: "B", Amount: 100}, transfer)
+	assertfatal.EqualError(err, nil, t)
+
+	items := []idempo.Item[transferInput]{
+		// Already processed.
+		{IdempotencyKey: "transfer-1", Input: transferInput{FromAccount: "A",
+			ToAccount: "B", Amount: 100}},
+		// Reuses the key with different input.
+		{IdempotencyKey: "transfer-1", Input: transferInput{FromAccount: "A",
+			ToAccount: "B", Amount: 200}},
+		{IdempotencyKey: "transfer-2", Input: transferInput{FromAccount: "A",
+			ToAccount: "B", Amount: 300}},
+		// Insufficient funds.
+		{IdempotencyKey: "transfer-3", Input: transferInput{FromAccount: "A",
+			ToAccount: "B", Amount: 1000}},
+	}
+	results, err := wrapper.WrapBatch(context.TODO(), items, transfer)
+	assertfatal.EqualError(err, nil, t)
+	assertfatal.Equal(len(results), 4, t)
+	assertfatal.EqualError(results[0].Err, nil, t)
+	assertfatal.EqualError(results[1].Err, idempo.ErrHashMismatch, t)
+	assertfatal.EqualError(results[2].Err, nil, t)
+	assertfatal.Equal(isUUID(results[2].SuccessOutput.TransactionID), true, t)
+	assertfatal.EqualError(results[3].Err, errInsufficientFunds, t)
+
+	assertfatal.Equal(getBalance(db, "A"), 600, t)
+	assertfatal.Equal(getBalance(db, "B"), 1400, t)
+	assertfatal.Equal(getRecord(db, "transfer-3").SuccessOutput, false, t)
+}
+
+func TestWrapBatchNotPersistedFailure(t *testing.T) {
+	var (
+		db      = newDB()
+		wrapper = idempo.NewWrapper[repos, transferInput](
+			newConf(newUnitOfWork(db)))
+		errUnavailable = errors.New("service unavailable")
+		executed       []string
+		action         = func(ctx context.Context, repos repos,
+			idempotencyKey string, input transferInput,
+		) (result transferSuccess, err error) {
+			executed = append(executed, idempotencyKey)
+			if result, err = transfer(ctx, repos, idempotencyKey, input); err != nil {
+				return
+			}
+			if idempotencyKey == "transfer-2" {
+				err = errUnavailable
+			}
+			return
+		}
+		input = transferInput{FromAccount: "A", ToAccount: "B", Amount: 100}
+		items = []idempo.Item[transferInput]{
+			{IdempotencyKey: "transfer-1", Input: input},
+			{IdempotencyKey: "transfer-2", Input: input},
+			{IdempotencyKey: "transfer-3", Input: input},
+			{IdempotencyKey: "transfer-2", Input: input},
+		}
+	)
+	results, err := wrapper.WrapBatch(context.TODO(), items, action)
+	assertfatal.EqualError(err, nil, t)
+	assertfatal.Equal(len(results), 4, t)
+
+	t.Run("Should report the error for the failed Item", func(t *testing.T) {
+		assertfatal.EqualError(results[1].Err, errUnavailable, t)
+		assertfatal.EqualError(results[3].Err, errUnavailable, t)
+		assertfatal.Equal(getRecord(db, "transfer-2").ID, "", t)
+	})
+
+	t.Run("Should commit the other Items", func(t *testing.T) {
+		assertfatal.EqualError(results[0].Err, nil, t)
+		assertfatal.EqualError(results[2].Err, nil, t)
+		assertfatal.Equal(getRecord(db, "transfer-1").SuccessOutput, true, t)
+		assertfatal.Equal(getRecord(db, "transfer-3").SuccessOutput, true, t)
+	})
+
+	t.Run("Should roll back the side effects of the failed Item",
+		func(t *testing.T) {
+			assertfatal.Equal(strings.Join(executed, ","),
+				"transfer-1,transfer-2,transfer-1,transfer-3", t)
+			assertfatal.Equal(getBalance(db, "A"), 800, t)
+			assertfatal.Equal(getBalance(db, "B"), 1200, t)
+		})
+}
+
+func TestWrapBatchStoreError(t *testing.T) {
+	var (
+		db       = newDB()
+		conf     = newConf(newUnitOfWork(db))
+		errStore = errors.New("store error")
+	)
+	conf.SuccessSer = failingSerializer{errStore}
+	var (
+		wrapper = idempo.NewWrapper[repos, transferInput](conf)
+		input   = transferInput{FromAccount: "A", ToAccount: "B", Amount: 100}
+		items   = []idempo.Item[transferInput]{
+			{IdempotencyKey: "transfer-1", Input: input},
+			{IdempotencyKey: "transfer-2", Input: input},
+		}
+	)
+	results, err := wrapper.WrapBatch(context.TODO(), items, transfer)
+	assertfatal.Equal(errors.Is(err, errStore), true, t)
+	assertfatal.Equal(results == nil, true, t)
+	assertfatal.Equal(getBalance(db, "A"), 1000, t)
+}
+
+func TestWrapBatchExpiredLease(t *testing.T) {
+	var (
+		db      = newDB()
+		wrapper = idempo.NewWrapper[repos, transferInput](
+			newConf(newUnitOfWork(db)))
+		input        = transferInput{FromAccount: "A", ToAccount: "B", Amount: 100}
+		inputHash, _ = input.Hash()
+	)
+	putRecord(db, idempo.Record{
+		ID:             "transfer-1",
+		InputHash:      inputHash,
+		InProgress:     true,
+		LeaseOwner:     "worker-1",
+		LeaseExpiresAt: time.Now().Add(-time.Second),
+		FencingToken:   1,
+	})
+	putRecord(db, idempo.Record{
+		ID:             "transfer-2",
+		InputHash:      inputHash,
+		InProgress:     true,
+		LeaseOwner:     "worker-1",
+		LeaseExpiresAt: time.Now().Add(time.Hour),
+		FencingToken:   1,
+	})
+	results, err := wrapper.WrapBatch(context.TODO(), []idempo.Item[transferInput]{
+		{IdempotencyKey: "transfer-1", Input: input},
+		{IdempotencyKey: "transfer-2", Input: input},
+	}, transfer)
+	assertfatal.EqualError(err, nil, t)
+
+	t.Run("Should take over an expired lease", func(t *testing.T) {
+		assertfatal.EqualError(results[0].Err, nil, t)
+		assertfatal.Equal(isUUID(results[0].SuccessOutput.TransactionID), true, t)
+		assertfatal.Equal(getRecord(db, "transfer-1").InProgress, false, t)
+		assertfatal.Equal(getBalance(db, "A"), 900, t)
+	})
+
+	t.Run("Should not take over a held lease", func(t *testing.T) {
+		assertfatal.EqualError(results[1].Err, idempo.ErrInProgress, t)
+		assertfatal.Equal(getRecord(db, "transfer-2").InProgress, true, t)
+	})
+}
+
+// failingSerializer fails to marshal, so the Records can't be saved.
+type failingSerializer struct {
+	err error
+}
+
+func (s failingSerializer) Marshal(v transferSuccess) ([]byte, error) {
+	return nil, s.err
+}
+
+func (s failingSerializer) Unmarshal(bs []byte) (transferSuccess, error) {
+	return transferSuccess{}, s.err
+}
@@ -10,9 +10,49 @@ type Config[T UOWRepos, S, F any] struct {
 	SuccessSer Serializer[S]
 	// FailureSer serializes failure results (F) for storage.
 	FailureSer Serializer[F]
-	// ErrorToFailure maps a runtime error to a storable failure (F).
-	// Returns ok=false if the error should not be persisted.
-	ErrorToFailure func(err error) (ok bool, failure F)
+	// ErrorToFailure maps a runtime error to a storable failure (F) and
+	// defines how it should be persisted: PersistPermanent, PersistFor(ttl),
+	// or PersistNone if the error should not be persisted.
+	ErrorToFailure func(err error) (persistence Persistence, failure F)
 	// FailureToError converts a stored failure (F) back into a Go error.
 	FailureToError func(failure F) error
+	// InputHasher derives the persisted input hash from the Hasher output.
+	// Optional, if nil, the Hasher output is persisted as is.
+	InputHasher InputHasher
+	// HashVersions lists the tags of the input hash versions, ordered from the
+	// oldest to the newest. The input must implement the VersionedHasher
+	// interface. New Records get the hash of the newest version, and a stored
+	// Record matches if its hash equals the hash of the version it is tagged
+	// with. Untagged hashes, saved before versioning was introduced, are
+	// compared with Hasher.Hash. Optional, if empty, inputs are hashed with
+	// Hasher.Hash.
+	HashVersions []string
+	// RewriteInputHash enables rewriting, on replay, of Records saved with a
+	// previous input hash (e.g. an older HashVersion or a rotated secret) to the
+	// current one.
+	RewriteInputHash bool
+	// KeyScope composes idempotency keys with the operation name and tenant
+	// into the stored Record ID. Optional, if zero, keys are stored as is.
+	KeyScope KeyScope
+	// KeyValidator validates idempotency keys before any UnitOfWork is opened.
+	// Optional.
+	KeyValidator KeyValidator
+	// WorkerPool executes Actions accepted with Wrapper.Submit. Optional, if
+	// nil, Submit is not available.
+	WorkerPool *WorkerPool
+	// Lease configures leases on in-progress Records. Optional, if zero,
+	// in-progress Records never expire.
+	Lease Lease
+	// SingleFlight enables deduplication of concurrent Wrap calls with the same
+	// idempotency key within the process: only one of them opens a UnitOfWork,
+	// while the others wait for its outcome.
+	SingleFlight bool
+	// RetryPolicy defines how a UnitOfWork that has failed with a transient
+	// error (e.g. a serialization failure) is retried. Optional, if zero,
+	// errors are returned as is.
+	RetryPolicy RetryPolicy
+	// Locker acquires a per-key lock around the idempotency check, the Action
+	// execution and saving of its output. Optional, required for Stores
+	// without transactions.
+	Locker Locker
 }
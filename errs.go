@@ -17,8 +17,39 @@ var (
 	// original, completed execution.
 	// This indicates a misuse of the idempotency key.
 	ErrHashMismatch = errors.New(ErrorPrefix + "idempotency key already used with different input data")
+	// ErrNotVersionedHasher is returned when the Config defines HashVersions,
+	// but the Action input doesn't implement the VersionedHasher interface.
+	ErrNotVersionedHasher = errors.New(ErrorPrefix + "input doesn't implement VersionedHasher")
+	// ErrInvalidIdempotencyKey is returned when the idempotency key is rejected
+	// by the KeyValidator.
+	ErrInvalidIdempotencyKey = errors.New(ErrorPrefix + "invalid idempotency key")
+	// ErrInProgress is returned when the execution associated with the
+	// idempotency key has been accepted, but not yet completed.
+	ErrInProgress = errors.New(ErrorPrefix + "execution in progress")
+	// ErrNoWorkerPool is returned by Wrapper.Submit when the Config doesn't
+	// specify a WorkerPool.
+	ErrNoWorkerPool = errors.New(ErrorPrefix + "no worker pool")
+	// ErrWorkerPoolClosed is returned by Wrapper.Submit when the WorkerPool is
+	// closed.
+	ErrWorkerPoolClosed = errors.New(ErrorPrefix + "worker pool closed")
+	// ErrStoreNotFenced is returned when an operation requires the Store to
+	// implement the FencedStore interface, but it doesn't.
+	ErrStoreNotFenced = errors.New(ErrorPrefix + "store doesn't support fenced writes")
+	// ErrStoreNotUpdater is returned when an operation requires the Store to
+	// implement the Updater interface, but it doesn't.
+	ErrStoreNotUpdater = errors.New(ErrorPrefix + "store doesn't support updates")
+	// ErrLeaseLost is returned when the lease on an in-progress Record was
+	// taken over by another owner, so the outcome of the execution can't be
+	// saved.
+	ErrLeaseLost = errors.New(ErrorPrefix + "lease lost")
 )
 
+// NewInvalidIdempotencyKeyError returns an error that wraps
+// ErrInvalidIdempotencyKey and describes why the key was rejected.
+func NewInvalidIdempotencyKeyError(reason string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidIdempotencyKey, reason)
+}
+
 // NewSuccessOutputMarshalError wraps a low-level marshalling error.
 //
 // This error is returned by the StoreAdapter when it fails to marshal the
@@ -0,0 +1,222 @@
+package idempo_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-memdb"
+	"github.com/ymz-ncnk/idempo-go"
+	serializer "github.com/ymz-ncnk/idempo-go/serializer/json"
+	uow "github.com/ymz-ncnk/idempo-go/uow/memdb"
+)
+
+// The fixture is a money transfer between accounts, stored in MemDB together
+// with the idempotency records.
+
+const accountsTableName = "accounts"
+
+var errInsufficientFunds = errors.New("insufficient funds")
+
+// newDB creates a MemDB with the accounts "A" and "B", each with a balance of
+// 1000.
+func newDB() *memdb.MemDB {
+	db, err := memdb.NewMemDB(&memdb.DBSchema{
+		Tables: map[string]*memdb.TableSchema{
+			accountsTableName: {
+				Name: accountsTableName,
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": {
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "ID"},
+					},
+				},
+			},
+			uow.MemDBIdempotencyTableName: {
+				Name: uow.MemDBIdempotencyTableName,
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": {
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "ID"},
+					},
+					uow.MemDBScopeIndexName: {
+						Name:         uow.MemDBScopeIndexName,
+						AllowMissing: true,
+						Indexer:      &memdb.StringFieldIndex{Field: "Scope"},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	tx := db.Txn(true)
+	defer tx.Abort()
+	for _, id := range []string{"A", "B"} {
+		err = tx.Insert(accountsTableName, account{ID: id, Balance: 1000})
+		if err != nil {
+			panic(err)
+		}
+	}
+	tx.Commit()
+	return db
+}
+
+func newUnitOfWork(db *memdb.MemDB) *uow.UnitOfWork[repos] {
+	return uow.NewUnitOfWork(db, func(tx *memdb.Txn) repos {
+		return repos{tx: tx, store: uow.NewIdempotencyStore(tx)}
+	})
+}
+
+// newConf returns the Config of transfers, which persists errInsufficientFunds
+// permanently and doesn't persist other errors.
+func newConf(unitOfWork idempo.UnitOfWork[repos]) (
+	conf idempo.Config[repos, transferSuccess, transferFailure],
+) {
+	return idempo.Config[repos, transferSuccess, transferFailure]{
+		UnitOfWork: unitOfWork,
+		SuccessSer: serializer.JSONSerializer[transferSuccess]{},
+		FailureSer: serializer.JSONSerializer[transferFailure]{},
+		FailureToError: func(failure transferFailure) error {
+			return errInsufficientFunds
+		},
+		ErrorToFailure: func(err error) (persistence idempo.Persistence,
+			failure transferFailure,
+		) {
+			if errors.Is(err, errInsufficientFunds) {
+				return idempo.PersistPermanent, transferFailure{Reason: err.Error()}
+			}
+			return
+		},
+	}
+}
+
+// transfer is the Action that moves money between accounts.
+func transfer(ctx context.Context, repos repos, idempotencyKey string,
+	input transferInput,
+) (result transferSuccess, err error) {
+	from, err := repos.account(input.FromAccount)
+	if err != nil {
+		return
+	}
+	to, err := repos.account(input.ToAccount)
+	if err != nil {
+		return
+	}
+	if from.Balance < input.Amount {
+		err = errInsufficientFunds
+		return
+	}
+	from.Balance -= input.Amount
+	to.Balance += input.Amount
+	if err = repos.updateAccount(from); err != nil {
+		return
+	}
+	if err = repos.updateAccount(to); err != nil {
+		return
+	}
+	result.TransactionID = uuid.NewString()
+	return
+}
+
+// repos is the repository bundle of the fixture.
+type repos struct {
+	tx    *memdb.Txn
+	store idempo.Store
+}
+
+func (r repos) IdempotencyStore() idempo.Store {
+	return r.store
+}
+
+func (r repos) account(id string) (acc account, err error) {
+	raw, err := r.tx.First(accountsTableName, "id", id)
+	if err != nil {
+		return
+	}
+	return raw.(account), nil
+}
+
+func (r repos) updateAccount(acc account) error {
+	return r.tx.Insert(accountsTableName, acc)
+}
+
+type account struct {
+	ID      string
+	Balance int64
+}
+
+type transferInput struct {
+	FromAccount string
+	ToAccount   string
+	Amount      int64
+}
+
+func (in transferInput) Hash() (string, error) {
+	return fmt.Sprintf("%s:%s:%d", in.FromAccount, in.ToAccount, in.Amount), nil
+}
+
+// HashVersion implements the idempo.VersionedHasher interface.
+func (in transferInput) HashVersion(tag string) (string, error) {
+	switch tag {
+	case "v1":
+		return fmt.Sprintf("%s->%s:%d", in.FromAccount, in.ToAccount, in.Amount),
+			nil
+	case "v2":
+		return fmt.Sprintf("%d:%s->%s", in.Amount, in.FromAccount, in.ToAccount),
+			nil
+	default:
+		return "", fmt.Errorf("unknown hash version %q", tag)
+	}
+}
+
+type transferSuccess struct {
+	TransactionID string
+}
+
+type transferFailure struct {
+	Reason string
+}
+
+func getBalance(db *memdb.MemDB, id string) int64 {
+	tx := db.Txn(false)
+	defer tx.Abort()
+	raw, err := tx.First(accountsTableName, "id", id)
+	if err != nil {
+		panic(err)
+	}
+	return raw.(account).Balance
+}
+
+// getRecord returns the record with the given ID, or an empty one if there is
+// none.
+func getRecord(db *memdb.MemDB, id string) (record idempo.Record) {
+	tx := db.Txn(false)
+	defer tx.Abort()
+	raw, err := tx.First(uow.MemDBIdempotencyTableName, "id", id)
+	if err != nil {
+		panic(err)
+	}
+	if raw == nil {
+		return
+	}
+	return raw.(idempo.Record)
+}
+
+func putRecord(db *memdb.MemDB, record idempo.Record) {
+	tx := db.Txn(true)
+	defer tx.Abort()
+	if err := tx.Insert(uow.MemDBIdempotencyTableName, record); err != nil {
+		panic(err)
+	}
+	tx.Commit()
+}
+
+func isUUID(str string) bool {
+	_, err := uuid.Parse(str)
+	return err == nil
+}
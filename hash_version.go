@@ -0,0 +1,30 @@
+package idempo
+
+import "strings"
+
+// VersionedHasher is an optional interface an Action input may implement to
+// be hashed in several versions, identified by tags (see Config.HashVersions).
+//
+// Hashes produced by a version are persisted as "$<tag>$<hash>", so the way
+// inputs are hashed (e.g. adding a field or switching to canonical hashing)
+// can be changed without breaking retries of in-flight requests.
+type VersionedHasher interface {
+	// HashVersion calculates the hash of the input with the version identified
+	// by the tag.
+	HashVersion(tag string) (string, error)
+}
+
+func taggedHash(tag, hash string) string {
+	return "$" + tag + "$" + hash
+}
+
+// hashTag returns the tag of the stored hash. ok is false if the hash is not
+// tagged.
+func hashTag(hash string) (tag string, ok bool) {
+	rest, ok := strings.CutPrefix(hash, "$")
+	if !ok {
+		return
+	}
+	tag, _, ok = strings.Cut(rest, "$")
+	return
+}
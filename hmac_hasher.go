@@ -0,0 +1,49 @@
+package idempo
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// NewHMACHasher creates a new HMACHasher.
+//
+// secret is used to hash new inputs, while previous secrets (most recent
+// first) are used only to verify Records saved before the secret was rotated.
+func NewHMACHasher(secret []byte, previous ...[]byte) (h HMACHasher, err error) {
+	if len(secret) == 0 {
+		err = errors.New(ErrorPrefix + "empty HMAC secret")
+		return
+	}
+	h = HMACHasher{secret: secret, previous: previous}
+	return
+}
+
+// HMACHasher is an InputHasher that applies HMAC-SHA256 with a server secret
+// to the raw input signature.
+//
+// Signatures returned by Hasher.Hash often contain the input itself (account
+// numbers, names, etc.). Keyed hashing prevents anyone who can read the Store
+// from recovering or guessing them.
+type HMACHasher struct {
+	secret   []byte
+	previous [][]byte
+}
+
+func (h HMACHasher) InputHash(raw string) (inputHash InputHash, err error) {
+	inputHash.Value = hmacSHA256(h.secret, raw)
+	if len(h.previous) > 0 {
+		inputHash.Previous = make([]string, len(h.previous))
+		for i, secret := range h.previous {
+			inputHash.Previous[i] = hmacSHA256(secret, raw)
+		}
+	}
+	return
+}
+
+func hmacSHA256(secret []byte, raw string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(raw))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,54 @@
+package idempo
+
+import (
+	"testing"
+
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+)
+
+func TestHMACHasher(t *testing.T) {
+	const raw = "A:B:500"
+	var (
+		oldSecret = []byte("old-secret")
+		newSecret = []byte("new-secret")
+	)
+	oldHasher, err := NewHMACHasher(oldSecret)
+	assertfatal.EqualError(err, nil, t)
+	stored, err := oldHasher.InputHash(raw)
+	assertfatal.EqualError(err, nil, t)
+
+	t.Run("Should not persist the raw signature", func(t *testing.T) {
+		assertfatal.Equal(stored.Value != raw, true, t)
+		assertfatal.Equal(len(stored.Previous), 0, t)
+	})
+
+	t.Run("Should match hash of the previous secret", func(t *testing.T) {
+		hasher, err := NewHMACHasher(newSecret, oldSecret)
+		assertfatal.EqualError(err, nil, t)
+		inputHash, err := hasher.InputHash(raw)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(inputHash.Value != stored.Value, true, t)
+		assertfatal.Equal(inputHash.Match(stored.Value), true, t)
+	})
+
+	t.Run("Should not match hash of a wrong secret", func(t *testing.T) {
+		hasher, err := NewHMACHasher(newSecret, []byte("wrong-secret"))
+		assertfatal.EqualError(err, nil, t)
+		inputHash, err := hasher.InputHash(raw)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(inputHash.Match(stored.Value), false, t)
+	})
+
+	t.Run("Should not match hash of a different input", func(t *testing.T) {
+		inputHash, err := oldHasher.InputHash("A:B:1")
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(inputHash.Match(stored.Value), false, t)
+	})
+
+	t.Run("Should reject empty secret", func(t *testing.T) {
+		_, err := NewHMACHasher(nil)
+		assertfatal.Equal(err != nil, true, t)
+		_, err = NewHMACHasher([]byte{}, oldSecret)
+		assertfatal.Equal(err != nil, true, t)
+	})
+}
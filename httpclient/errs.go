@@ -0,0 +1,24 @@
+package httpclient
+
+import (
+	"fmt"
+
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// HashMismatchError is returned by the Transport when the server responds with
+// 422 Unprocessable Entity, marked as caused by reusing the idempotency key
+// with a different request.
+//
+// It matches idempo.ErrHashMismatch with errors.Is.
+type HashMismatchError struct {
+	IdempotencyKey string
+}
+
+func (e *HashMismatchError) Error() string {
+	return fmt.Sprintf("%s (key %q)", idempo.ErrHashMismatch, e.IdempotencyKey)
+}
+
+func (e *HashMismatchError) Unwrap() error {
+	return idempo.ErrHashMismatch
+}
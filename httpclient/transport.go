@@ -0,0 +1,237 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ymz-ncnk/idempo-go"
+	"github.com/ymz-ncnk/idempo-go/keys"
+)
+
+const (
+	// DefaultKeyHeader is the default name of the idempotency key header.
+	DefaultKeyHeader = "Idempotency-Key"
+	// DefaultMaxAttempts is the default maximum number of attempts per request.
+	DefaultMaxAttempts = 3
+	// DefaultInitialBackoff is the default delay before the first retry.
+	DefaultInitialBackoff = 100 * time.Millisecond
+	// DefaultMaxBackoff is the default upper bound of the delay between
+	// retries.
+	DefaultMaxBackoff = 5 * time.Second
+	// HashMismatchHeader is the response header with which servers mark a 422
+	// Unprocessable Entity response as caused by reusing the idempotency key
+	// with a different request.
+	HashMismatchHeader = "Idempotency-Key-Mismatch"
+)
+
+// Config configures the Transport. Zero fields are replaced with defaults.
+type Config struct {
+	// Base is the underlying RoundTripper, http.DefaultTransport by default.
+	Base http.RoundTripper
+	// KeyHeader is the name of the idempotency key header.
+	KeyHeader string
+	// NewKey generates idempotency keys for requests that don't have one,
+	// neither in the header nor in the context (see keys.WithKey).
+	// keys.NewUUIDv7 by default.
+	NewKey func() (string, error)
+	// MaxAttempts is the maximum number of attempts per request, including the
+	// first one.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry. It doubles with each
+	// subsequent retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the exponential backoff between retries. The delay
+	// requested by the server with Retry-After is not capped, the request
+	// context can be used to bound it.
+	MaxBackoff time.Duration
+	// IsHashMismatch reports whether a 422 Unprocessable Entity response means
+	// that the idempotency key was already used with a different request. If
+	// it reads the body, it must leave it readable. By default, it checks that
+	// the HashMismatchHeader is set.
+	IsHashMismatch func(resp *http.Response) bool
+}
+
+// NewTransport creates a new Transport.
+func NewTransport(conf Config) *Transport {
+	if conf.Base == nil {
+		conf.Base = http.DefaultTransport
+	}
+	if conf.KeyHeader == "" {
+		conf.KeyHeader = DefaultKeyHeader
+	}
+	if conf.NewKey == nil {
+		conf.NewKey = keys.NewUUIDv7
+	}
+	if conf.MaxAttempts <= 0 {
+		conf.MaxAttempts = DefaultMaxAttempts
+	}
+	if conf.InitialBackoff <= 0 {
+		conf.InitialBackoff = DefaultInitialBackoff
+	}
+	if conf.MaxBackoff <= 0 {
+		conf.MaxBackoff = DefaultMaxBackoff
+	}
+	if conf.IsHashMismatch == nil {
+		conf.IsHashMismatch = hasHashMismatchHeader
+	}
+	return &Transport{
+		conf: conf,
+		policy: idempo.RetryPolicy{
+			InitialBackoff: conf.InitialBackoff,
+			MaxBackoff:     conf.MaxBackoff,
+		},
+	}
+}
+
+// Transport is an http.RoundTripper for clients of idempotent endpoints.
+//
+// It assigns an idempotency key to requests with non-idempotent methods (POST
+// and PATCH) and retries them, keeping the key stable across attempts, with
+// exponential backoff and full jitter. Retries happen on network errors and on
+// the following statuses:
+//   - 409 Conflict, meaning the request with the same key is still in
+//     progress. The Retry-After header is honored.
+//   - 429 Too Many Requests, 502 Bad Gateway, 503 Service Unavailable and
+//     504 Gateway Timeout.
+//
+// A 422 Unprocessable Entity response, that the server has marked as caused by
+// reusing the key with a different request (see Config.IsHashMismatch), is
+// returned as a *HashMismatchError. Other 422 responses are returned as is.
+//
+// Requests with idempotent methods are retried as well, but without a key.
+type Transport struct {
+	conf Config
+	// policy calculates the backoff between attempts.
+	policy idempo.RetryPolicy
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response,
+	err error,
+) {
+	req, idempotencyKey, err := t.prepare(req)
+	if err != nil {
+		return
+	}
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			if req.Body, err = req.GetBody(); err != nil {
+				return
+			}
+		}
+		resp, err = t.conf.Base.RoundTrip(req)
+		if err == nil && resp.StatusCode == http.StatusUnprocessableEntity &&
+			idempotencyKey != "" && t.conf.IsHashMismatch(resp) {
+			resp.Body.Close()
+			return nil, &HashMismatchError{IdempotencyKey: idempotencyKey}
+		}
+		if attempt == t.conf.MaxAttempts || !retryable(req.Context(), resp, err) {
+			return
+		}
+		delay := t.backoff(attempt, resp)
+		if resp != nil {
+			// Drain the body so the connection can be reused.
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		if err = sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// prepare clones the request, assigns the idempotency key and makes the body
+// replayable.
+func (t *Transport) prepare(req *http.Request) (clone *http.Request,
+	idempotencyKey string, err error,
+) {
+	clone = req.Clone(req.Context())
+	if req.Method == http.MethodPost || req.Method == http.MethodPatch {
+		idempotencyKey = clone.Header.Get(t.conf.KeyHeader)
+		if idempotencyKey == "" {
+			var ok bool
+			if idempotencyKey, ok = keys.FromContext(req.Context()); !ok {
+				if idempotencyKey, err = t.conf.NewKey(); err != nil {
+					return
+				}
+			}
+			clone.Header.Set(t.conf.KeyHeader, idempotencyKey)
+		}
+	}
+	if clone.Body == nil || clone.Body == http.NoBody {
+		clone.GetBody = func() (io.ReadCloser, error) { return http.NoBody, nil }
+		return
+	}
+	if clone.GetBody == nil {
+		var body []byte
+		body, err = io.ReadAll(clone.Body)
+		clone.Body.Close()
+		if err != nil {
+			return
+		}
+		clone.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+		clone.Body, _ = clone.GetBody()
+	}
+	return
+}
+
+// backoff returns the delay before the next attempt.
+func (t *Transport) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if delay, ok := retryAfter(resp); ok {
+			return delay
+		}
+	}
+	return t.policy.Backoff(attempt)
+}
+
+func hasHashMismatchHeader(resp *http.Response) bool {
+	return resp.Header.Get(HashMismatchHeader) != ""
+}
+
+func retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil
+	}
+	switch resp.StatusCode {
+	case http.StatusConflict,
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses the Retry-After header, which contains either a number of
+// seconds or an HTTP date.
+func retryAfter(resp *http.Response) (delay time.Duration, ok bool) {
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return
+}
+
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,145 @@
+package httpclient
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+	"github.com/ymz-ncnk/idempo-go/keys"
+)
+
+func TestTransport(t *testing.T) {
+	conf := Config{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	t.Run("Should keep the key stable across retries", func(t *testing.T) {
+		var (
+			attempts int
+			reqKeys  []string
+			bodies   []string
+		)
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				reqKeys = append(reqKeys, r.Header.Get(DefaultKeyHeader))
+				body, _ := io.ReadAll(r.Body)
+				bodies = append(bodies, string(body))
+				if attempts == 1 {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(http.StatusConflict)
+					return
+				}
+				if attempts == 2 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+			}))
+		defer server.Close()
+
+		client := &http.Client{Transport: NewTransport(conf)}
+		resp, err := client.Post(server.URL, "text/plain", strings.NewReader("body"))
+		assertfatal.EqualError(err, nil, t)
+		resp.Body.Close()
+		assertfatal.Equal(resp.StatusCode, http.StatusCreated, t)
+		assertfatal.Equal(attempts, 3, t)
+		assertfatal.Equal(idempo.UUIDKey().Validate(reqKeys[0]), nil, t)
+		for i := range attempts {
+			assertfatal.Equal(reqKeys[i], reqKeys[0], t)
+			assertfatal.Equal(bodies[i], "body", t)
+		}
+	})
+
+	t.Run("Should use the key from context", func(t *testing.T) {
+		var reqKey string
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				reqKey = r.Header.Get(DefaultKeyHeader)
+			}))
+		defer server.Close()
+
+		req, err := http.NewRequestWithContext(
+			keys.WithKey(t.Context(), "transfer-123"), http.MethodPost, server.URL,
+			nil)
+		assertfatal.EqualError(err, nil, t)
+		resp, err := NewTransport(conf).RoundTrip(req)
+		assertfatal.EqualError(err, nil, t)
+		resp.Body.Close()
+		assertfatal.Equal(reqKey, "transfer-123", t)
+	})
+
+	t.Run("Should not add key to idempotent methods", func(t *testing.T) {
+		var reqKey = "none"
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				reqKey = r.Header.Get(DefaultKeyHeader)
+			}))
+		defer server.Close()
+
+		client := &http.Client{Transport: NewTransport(conf)}
+		resp, err := client.Get(server.URL)
+		assertfatal.EqualError(err, nil, t)
+		resp.Body.Close()
+		assertfatal.Equal(reqKey, "", t)
+	})
+
+	t.Run("Should return HashMismatchError on marked 422", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(HashMismatchHeader, "true")
+				w.WriteHeader(http.StatusUnprocessableEntity)
+			}))
+		defer server.Close()
+
+		client := &http.Client{Transport: NewTransport(conf)}
+		_, err := client.Post(server.URL, "text/plain", nil)
+		var hashMismatchErr *HashMismatchError
+		assertfatal.Equal(errors.As(err, &hashMismatchErr), true, t)
+		assertfatal.Equal(errors.Is(err, idempo.ErrHashMismatch), true, t)
+	})
+
+	t.Run("Should return unmarked 422 as is", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				io.WriteString(w, "invalid amount")
+			}))
+		defer server.Close()
+
+		client := &http.Client{Transport: NewTransport(conf)}
+		resp, err := client.Post(server.URL, "text/plain", nil)
+		assertfatal.EqualError(err, nil, t)
+		defer resp.Body.Close()
+		assertfatal.Equal(resp.StatusCode, http.StatusUnprocessableEntity, t)
+		body, err := io.ReadAll(resp.Body)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(string(body), "invalid amount", t)
+	})
+
+	t.Run("Should recognize custom hash mismatch marker", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/problem+json")
+				w.WriteHeader(http.StatusUnprocessableEntity)
+			}))
+		defer server.Close()
+
+		conf := conf
+		conf.IsHashMismatch = func(resp *http.Response) bool {
+			return resp.Header.Get("Content-Type") == "application/problem+json"
+		}
+		client := &http.Client{Transport: NewTransport(conf)}
+		_, err := client.Post(server.URL, "text/plain", nil)
+		assertfatal.Equal(errors.Is(err, idempo.ErrHashMismatch), true, t)
+	})
+
+	t.Run("Should honor Retry-After beyond MaxBackoff", func(t *testing.T) {
+		resp := &http.Response{Header: http.Header{"Retry-After": {"30"}}}
+		assertfatal.Equal(NewTransport(conf).backoff(1, resp), 30*time.Second, t)
+	})
+}
@@ -0,0 +1,53 @@
+package idempo
+
+import "slices"
+
+// InputHash is the signature of an Action input as it is persisted and
+// compared by the StoreAdapter.
+type InputHash struct {
+	// Value is persisted with new Records.
+	Value string
+	// Previous holds hashes of the same input produced in the past, e.g. with
+	// a rotated secret. A stored Record that matches one of them is still
+	// considered to be made with the same input.
+	Previous []string
+	// Rewrite tells the StoreAdapter to update a Record that matched one of
+	// the Previous hashes to Value, if the Store implements the Updater
+	// interface.
+	Rewrite bool
+	// resolve calculates hashes of the same input comparable with the stored
+	// one, e.g. with the hash version the stored hash is tagged with.
+	resolve func(stored string) (InputHash, error)
+}
+
+// Match reports whether the stored hash was produced from the same input.
+func (h InputHash) Match(stored string) bool {
+	return stored == h.Value || slices.Contains(h.Previous, stored)
+}
+
+// resolveFor returns the InputHash whose Previous hashes are extended with the
+// ones calculated on demand for the stored hash, e.g. with the older hash
+// version the stored hash is tagged with.
+func (h InputHash) resolveFor(stored string) (InputHash, error) {
+	if h.resolve == nil || h.Match(stored) {
+		return h, nil
+	}
+	resolved, err := h.resolve(stored)
+	if err != nil {
+		return h, err
+	}
+	previous := slices.Concat(h.Previous, []string{resolved.Value},
+		resolved.Previous)
+	h.Previous = slices.DeleteFunc(previous, func(hash string) bool {
+		return hash == ""
+	})
+	return h, nil
+}
+
+// InputHasher derives the InputHash from the raw signature returned by
+// Hasher.Hash.
+//
+// If the Config doesn't specify one, the raw signature is persisted as is.
+type InputHasher interface {
+	InputHash(raw string) (InputHash, error)
+}
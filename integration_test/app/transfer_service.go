@@ -13,20 +13,46 @@ import (
 
 // NewTransferService constructs a TransferService that executes
 // transfers atomically and idempotently using the provided UnitOfWork.
-func NewTransferService(unitOfWork idempo.UnitOfWork[RepositoryBundle]) TransferService {
+// Inputs are hashed with the given hash versions, if any.
+func NewTransferService(unitOfWork idempo.UnitOfWork[RepositoryBundle],
+	hashVersions ...string,
+) TransferService {
+	return newTransferService(unitOfWork, nil, idempo.Lease{}, hashVersions)
+}
+
+// NewAsyncTransferService constructs a TransferService that can also execute
+// transfers asynchronously using the provided WorkerPool. Submitted transfers
+// are executed under the given lease.
+func NewAsyncTransferService(unitOfWork idempo.UnitOfWork[RepositoryBundle],
+	pool *idempo.WorkerPool,
+	lease idempo.Lease,
+) TransferService {
+	return newTransferService(unitOfWork, pool, lease, nil)
+}
+
+func newTransferService(unitOfWork idempo.UnitOfWork[RepositoryBundle],
+	pool *idempo.WorkerPool,
+	lease idempo.Lease,
+	hashVersions []string,
+) TransferService {
 	conf := idempo.Config[RepositoryBundle, dto.TransferSuccess, dto.TransferFailure]{
-		UnitOfWork: unitOfWork,
-		SuccessSer: serializer.JSONSerializer[dto.TransferSuccess]{},
-		FailureSer: serializer.JSONSerializer[dto.TransferFailure]{},
+		UnitOfWork:   unitOfWork,
+		WorkerPool:   pool,
+		Lease:        lease,
+		HashVersions: hashVersions,
+		SuccessSer:   serializer.JSONSerializer[dto.TransferSuccess]{},
+		FailureSer:   serializer.JSONSerializer[dto.TransferFailure]{},
 		FailureToError: func(failure dto.TransferFailure) error {
 			return domain.ErrInsufficientFunds
 		},
-		ErrorToFailure: func(err error) (ok bool, failure dto.TransferFailure) {
+		ErrorToFailure: func(err error) (persistence idempo.Persistence,
+			failure dto.TransferFailure,
+		) {
 			if errors.Is(err, domain.ErrInsufficientFunds) {
-				return true, dto.TransferFailure{Reason: err.Error()}
+				return idempo.PersistPermanent, dto.TransferFailure{Reason: err.Error()}
 			}
 			// All other errors (e.g., context.DeadlineExceeded, DB errors) are not
-			// stored (ok=false),
+			// stored (PersistNone).
 			return
 		},
 	}
@@ -52,6 +78,41 @@ func (s TransferService) Transfer(ctx context.Context, idempotencyKey string,
 	return s.wrapper.Wrap(ctx, idempotencyKey, input, s.doTransfer)
 }
 
+// SubmitTransfer accepts a money transfer for asynchronous execution. Use
+// TransferStatus to poll for its outcome.
+func (s TransferService) SubmitTransfer(ctx context.Context,
+	idempotencyKey string,
+	input dto.TransferInput,
+) (handle idempo.Handle, err error) {
+	return s.wrapper.Submit(ctx, idempotencyKey, input, s.doTransfer)
+}
+
+// TransferStatus returns the state of the transfer accepted with
+// SubmitTransfer.
+func (s TransferService) TransferStatus(ctx context.Context,
+	idempotencyKey string,
+) (execution idempo.Execution[dto.TransferSuccess], err error) {
+	return s.wrapper.Status(ctx, idempotencyKey)
+}
+
+// TransferIn executes a money transfer wrapped in idempotency handling within
+// an already running transaction, so it can be committed together with other
+// operations.
+func (s TransferService) TransferIn(ctx context.Context, repos RepositoryBundle,
+	idempotencyKey string,
+	input dto.TransferInput,
+) (result dto.TransferSuccess, err error) {
+	return s.wrapper.WrapIn(ctx, repos, idempotencyKey, input, s.doTransfer)
+}
+
+// TransferBatch executes many transfers within a single transaction, each
+// with its own idempotency key.
+func (s TransferService) TransferBatch(ctx context.Context,
+	items []idempo.Item[dto.TransferInput],
+) (results []idempo.ItemResult[dto.TransferSuccess], err error) {
+	return s.wrapper.WrapBatch(ctx, items, s.doTransfer)
+}
+
 // doTransfer executes a money transfer.
 func (s TransferService) doTransfer(ctx context.Context,
 	repos RepositoryBundle,
@@ -11,3 +11,17 @@ type TransferInput struct {
 func (in TransferInput) Hash() (string, error) {
 	return fmt.Sprintf("%s:%s:%d", in.FromAccount, in.ToAccount, in.Amount), nil
 }
+
+// HashVersion implements the idempo.VersionedHasher interface.
+func (in TransferInput) HashVersion(tag string) (string, error) {
+	switch tag {
+	case "v1":
+		return fmt.Sprintf("%s->%s:%d", in.FromAccount, in.ToAccount, in.Amount),
+			nil
+	case "v2":
+		return fmt.Sprintf("%d:%s->%s", in.Amount, in.FromAccount, in.ToAccount),
+			nil
+	default:
+		return "", fmt.Errorf("unknown hash version %q", tag)
+	}
+}
@@ -53,5 +53,10 @@ var IdempotencyRecordSchema = &memdb.TableSchema{
 			Unique:  true,
 			Indexer: &memdb.StringFieldIndex{Field: "ID"}, // Index by the Idempotency Key
 		},
+		"scope": {
+			Name:         "scope",
+			AllowMissing: true,
+			Indexer:      &memdb.StringFieldIndex{Field: "Scope"},
+		},
 	},
 }
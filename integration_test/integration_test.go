@@ -2,16 +2,21 @@ package intest
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/google/uuid"
 	"github.com/hashicorp/go-memdb"
 	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
 	"github.com/ymz-ncnk/idempo-go/integration_test/app"
 	"github.com/ymz-ncnk/idempo-go/integration_test/domain"
 	"github.com/ymz-ncnk/idempo-go/integration_test/dto"
 	infra "github.com/ymz-ncnk/idempo-go/integration_test/infra/memdb"
+	serializer "github.com/ymz-ncnk/idempo-go/serializer/json"
 	uow "github.com/ymz-ncnk/idempo-go/uow/memdb"
+	"github.com/ymz-ncnk/idempo-go/workflow"
 )
 
 // TestIdempotency demonstrates how to use the idempotency wrapper
@@ -111,6 +116,10 @@ func TestIdempotency(t *testing.T) {
 // The UnitOfWork ensures that both the business action (money transfer)
 // and the idempotency record are executed atomically in the same transaction.
 func makeService(db *memdb.MemDB) app.TransferService {
+	return app.NewTransferService(makeUnitOfWork(db))
+}
+
+func makeUnitOfWork(db *memdb.MemDB) *uow.UnitOfWork[app.RepositoryBundle] {
 	var (
 		// The factory creates a new RepositoryBundle for each transaction,
 		// containing both the IdempotencyStore and the AccountRepository.
@@ -119,9 +128,8 @@ func makeService(db *memdb.MemDB) app.TransferService {
 			bundle.AccountRepo = infra.NewAccountRepository(tx)
 			return bundle
 		}
-		unitOfWork = uow.NewUnitOfWork(db, factory)
 	)
-	return app.NewTransferService(unitOfWork)
+	return uow.NewUnitOfWork(db, factory)
 }
 
 func fillDB(db *memdb.MemDB) {
@@ -147,7 +155,161 @@ func getAccount(db *memdb.MemDB, id string) domain.Account {
 	return acc.(domain.Account)
 }
 
+func getRecord(db *memdb.MemDB, id string) idempo.Record {
+	tx := db.Txn(false)
+	defer tx.Abort()
+	record, err := tx.First(infra.IdempotencyRecordsTableName, "id", id)
+	if err != nil {
+		panic(err)
+	}
+	return record.(idempo.Record)
+}
+
 func isUUID(str string) bool {
 	_, err := uuid.Parse(str)
 	return err == nil
 }
+
+// TestWorkflow demonstrates how to resume a multi-step operation after a
+// failure.
+func TestWorkflow(t *testing.T) {
+	db, err := infra.NewMemDB()
+	if err != nil {
+		panic(err)
+	}
+	var (
+		wf = workflow.New(makeUnitOfWork(db), "order-123",
+			dto.TransferInput{FromAccount: "A", ToAccount: "B", Amount: 1})
+		errUnavailable = errors.New("service unavailable")
+		calls          = map[string]int{}
+		failPayment    = true
+		step           = func(name string) workflow.Step[app.RepositoryBundle, string] {
+			return workflow.Step[app.RepositoryBundle, string]{
+				Name:       name,
+				Serializer: serializer.JSONSerializer[string]{},
+				Run: func(ctx context.Context, repos app.RepositoryBundle,
+					stepKey string,
+				) (output string, err error) {
+					calls[name]++
+					if name == "payment" && failPayment {
+						err = errUnavailable
+						return
+					}
+					output = name + "-" + uuid.NewString()
+					return
+				},
+			}
+		}
+		run = func() (outputs []string, err error) {
+			for _, name := range []string{"reservation", "payment", "shipment"} {
+				var output string
+				output, err = workflow.Execute(context.TODO(), wf, step(name))
+				if err != nil {
+					return
+				}
+				outputs = append(outputs, output)
+			}
+			return
+		}
+	)
+	_, err = run()
+	assertfatal.EqualError(err, errUnavailable, t)
+
+	t.Run("Should resume from the first incomplete step", func(t *testing.T) {
+		failPayment = false
+		outputs, err := run()
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(calls["reservation"], 1, t)
+		assertfatal.Equal(calls["payment"], 2, t)
+		assertfatal.Equal(calls["shipment"], 1, t)
+		assertfatal.Equal(getRecord(db, "order-123/reservation").Output != nil, true, t)
+
+		replayed, err := run()
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(strings.Join(replayed, ","), strings.Join(outputs, ","), t)
+		assertfatal.Equal(calls["shipment"], 1, t)
+	})
+}
+
+// TestSaga demonstrates how to compensate completed steps when a later one
+// fails.
+func TestSaga(t *testing.T) {
+	db, err := infra.NewMemDB()
+	if err != nil {
+		panic(err)
+	}
+	fillDB(db)
+	var (
+		unitOfWork = makeUnitOfWork(db)
+		input      = dto.TransferInput{FromAccount: "A", ToAccount: "B", Amount: 1500}
+		wf         = workflow.New(unitOfWork, "order-123", input)
+		isBusiness = func(err error) bool {
+			return errors.Is(err, domain.ErrInsufficientFunds)
+		}
+		compensations int
+		reserve       = workflow.SagaStep[app.RepositoryBundle, string]{
+			Step: workflow.Step[app.RepositoryBundle, string]{
+				Name:       "reservation",
+				Serializer: serializer.JSONSerializer[string]{},
+				Run: func(ctx context.Context, repos app.RepositoryBundle,
+					stepKey string,
+				) (string, error) {
+					return "reservation-" + uuid.NewString(), nil
+				},
+			},
+			Compensate: func(ctx context.Context, repos app.RepositoryBundle,
+				stepKey string, reservation string,
+			) error {
+				compensations++
+				return nil
+			},
+		}
+		pay = workflow.SagaStep[app.RepositoryBundle, struct{}]{
+			Step: workflow.Step[app.RepositoryBundle, struct{}]{
+				Name:       "payment",
+				Serializer: serializer.JSONSerializer[struct{}]{},
+				Run: func(ctx context.Context, repos app.RepositoryBundle,
+					stepKey string,
+				) (output struct{}, err error) {
+					from, err := repos.AccountRepo.Get(input.FromAccount)
+					if err != nil {
+						return
+					}
+					to, err := repos.AccountRepo.Get(input.ToAccount)
+					if err != nil {
+						return
+					}
+					err = domain.Transfer(&from, &to, input.Amount)
+					return
+				},
+			},
+		}
+		run = func() (err error) {
+			var (
+				ctx  = context.TODO()
+				saga = workflow.NewSaga(wf, isBusiness)
+			)
+			if _, err = workflow.ExecuteSagaStep(ctx, saga, reserve); err != nil {
+				return
+			}
+			if _, err = workflow.ExecuteSagaStep(ctx, saga, pay); err != nil {
+				return
+			}
+			return saga.Complete(ctx)
+		}
+	)
+	err = run()
+	assertfatal.EqualError(err, domain.ErrInsufficientFunds, t)
+	assertfatal.Equal(compensations, 1, t)
+	state, err := workflow.QuerySagaState(context.TODO(), unitOfWork, "order-123")
+	assertfatal.EqualError(err, nil, t)
+	assertfatal.Equal(state, workflow.SagaCompensated, t)
+
+	t.Run("Should not compensate twice on re-run", func(t *testing.T) {
+		err := run()
+		var stepFailedErr *workflow.StepFailedError
+		assertfatal.Equal(errors.As(err, &stepFailedErr), true, t)
+		assertfatal.Equal(stepFailedErr.StepName, "payment", t)
+		assertfatal.Equal(compensations, 1, t)
+	})
+}
@@ -0,0 +1,62 @@
+package idempo
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Key identifies the Record of an Action execution.
+type Key struct {
+	// IdempotencyKey is the key provided by the caller.
+	IdempotencyKey string
+	// Scope is the scope the idempotency key belongs to. Empty if the key is
+	// not scoped.
+	Scope string
+}
+
+// ID returns the Record ID, which is the IdempotencyKey prefixed with the
+// Scope, if any.
+//
+// Scopes never contain '#' and are not empty, so an unscoped IdempotencyKey
+// that contains '#' is prefixed with '#' to never collide with a scoped one,
+// e.g. "a#b" with the key "b" of the scope "a".
+func (k Key) ID() string {
+	if k.Scope == "" {
+		if strings.Contains(k.IdempotencyKey, "#") {
+			return "#" + k.IdempotencyKey
+		}
+		return k.IdempotencyKey
+	}
+	return k.Scope + "#" + k.IdempotencyKey
+}
+
+// KeyScope defines the scope in which idempotency keys are unique.
+//
+// Without a scope, two different Actions, or two tenants, using the same
+// idempotency key would collide: one would see the Record of the other or a
+// false ErrHashMismatch.
+type KeyScope struct {
+	// Operation is the name of the protected Action.
+	Operation string
+	// Tenant extracts the tenant ID from the context. Optional.
+	Tenant func(ctx context.Context) (string, error)
+}
+
+// Scope returns the scope for the given context in the form
+// "<operation>[/<tenant>]". Components are escaped, so the scope never
+// contains '#'.
+func (s KeyScope) Scope(ctx context.Context) (scope string, err error) {
+	scope = url.PathEscape(s.Operation)
+	if s.Tenant == nil {
+		return
+	}
+	tenant, err := s.Tenant(ctx)
+	if err != nil {
+		err = fmt.Errorf(ErrorPrefix+"failed to extract tenant: %w", err)
+		return
+	}
+	scope += "/" + url.PathEscape(tenant)
+	return
+}
@@ -0,0 +1,36 @@
+package idempo
+
+import (
+	"context"
+	"testing"
+
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+)
+
+func TestKey(t *testing.T) {
+	t.Run("Should not prefix unscoped keys", func(t *testing.T) {
+		assertfatal.Equal(Key{IdempotencyKey: "order-1"}.ID(), "order-1", t)
+	})
+
+	t.Run("Should prefix keys with the scope", func(t *testing.T) {
+		assertfatal.Equal(Key{IdempotencyKey: "order-1", Scope: "transfer"}.ID(),
+			"transfer#order-1", t)
+	})
+
+	t.Run("Should not collide unscoped keys with scoped ones",
+		func(t *testing.T) {
+			scope, err := KeyScope{Operation: "a#"}.Scope(context.Background())
+			assertfatal.EqualError(err, nil, t)
+			for _, key := range []Key{
+				{IdempotencyKey: "b", Scope: "a"},
+				{IdempotencyKey: "#b", Scope: "a"},
+				{IdempotencyKey: "b", Scope: scope},
+			} {
+				for _, unscoped := range []string{"a#b", "a##b", "#a#b",
+					key.Scope + "#" + key.IdempotencyKey} {
+					assertfatal.Equal(Key{IdempotencyKey: unscoped}.ID() != key.ID(),
+						true, t)
+				}
+			}
+		})
+}
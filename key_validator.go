@@ -0,0 +1,111 @@
+package idempo
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// URLSafeCharset contains characters that can be used in URLs and HTTP
+// headers without escaping.
+const URLSafeCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_.~"
+
+// CrockfordCharset is Crockford's base32 alphabet, used by ULIDs.
+const CrockfordCharset = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// KeyValidator validates an idempotency key. The Wrapper calls it before any
+// UnitOfWork is opened.
+type KeyValidator interface {
+	// Validate returns an error wrapping ErrInvalidIdempotencyKey if the key
+	// is not valid.
+	Validate(idempotencyKey string) error
+}
+
+// KeyValidatorFunc is an adapter to allow the use of ordinary functions as
+// KeyValidators.
+type KeyValidatorFunc func(idempotencyKey string) error
+
+func (f KeyValidatorFunc) Validate(idempotencyKey string) error {
+	return f(idempotencyKey)
+}
+
+// KeyValidators combines several validators into one, which applies them in
+// order and returns the first error.
+func KeyValidators(validators ...KeyValidator) KeyValidator {
+	return KeyValidatorFunc(func(idempotencyKey string) error {
+		for _, validator := range validators {
+			if err := validator.Validate(idempotencyKey); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// NonEmptyKey rejects empty keys.
+func NonEmptyKey() KeyValidator {
+	return KeyValidatorFunc(func(idempotencyKey string) error {
+		if idempotencyKey == "" {
+			return NewInvalidIdempotencyKeyError("empty key")
+		}
+		return nil
+	})
+}
+
+// MaxKeyLength rejects keys longer than maxLen bytes.
+func MaxKeyLength(maxLen int) KeyValidator {
+	return KeyValidatorFunc(func(idempotencyKey string) error {
+		if len(idempotencyKey) > maxLen {
+			return NewInvalidIdempotencyKeyError(
+				fmt.Sprintf("key length %d exceeds %d", len(idempotencyKey), maxLen))
+		}
+		return nil
+	})
+}
+
+// KeyCharset rejects keys containing characters not present in charset,
+// e.g. URLSafeCharset.
+func KeyCharset(charset string) KeyValidator {
+	return KeyValidatorFunc(func(idempotencyKey string) error {
+		for i, r := range idempotencyKey {
+			if r == utf8.RuneError || !strings.ContainsRune(charset, r) {
+				return NewInvalidIdempotencyKeyError(
+					fmt.Sprintf("invalid character at position %d", i))
+			}
+		}
+		return nil
+	})
+}
+
+// UUIDKey rejects keys that are not UUIDs in the canonical
+// xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx form.
+func UUIDKey() KeyValidator {
+	return KeyValidatorFunc(func(idempotencyKey string) error {
+		if len(idempotencyKey) != 36 {
+			return NewInvalidIdempotencyKeyError("not a UUID")
+		}
+		if _, err := uuid.Parse(idempotencyKey); err != nil {
+			return NewInvalidIdempotencyKeyError("not a UUID")
+		}
+		return nil
+	})
+}
+
+// ULIDKey rejects keys that are not ULIDs.
+func ULIDKey() KeyValidator {
+	return KeyValidatorFunc(func(idempotencyKey string) error {
+		// The first character can't exceed '7', otherwise the 48-bit timestamp
+		// overflows.
+		if len(idempotencyKey) != 26 || idempotencyKey[0] > '7' {
+			return NewInvalidIdempotencyKeyError("not a ULID")
+		}
+		for _, r := range strings.ToUpper(idempotencyKey) {
+			if !strings.ContainsRune(CrockfordCharset, r) {
+				return NewInvalidIdempotencyKeyError("not a ULID")
+			}
+		}
+		return nil
+	})
+}
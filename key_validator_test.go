@@ -0,0 +1,114 @@
+package idempo
+
+import (
+	"errors"
+	"testing"
+
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+)
+
+func TestKeyCharset(t *testing.T) {
+	var (
+		urlSafe   = KeyCharset(URLSafeCharset)
+		crockford = KeyCharset(CrockfordCharset)
+	)
+
+	t.Run("Should accept keys of the charset", func(t *testing.T) {
+		for _, key := range []string{
+			"",
+			"order-1_A.b~",
+			"01ARZ3NDEKTSV4RRFFQ69G5FAV",
+		} {
+			assertfatal.EqualError(urlSafe.Validate(key), nil, t)
+		}
+		assertfatal.EqualError(crockford.Validate("01ARZ3NDEKTSV4RRFFQ69G5FAV"),
+			nil, t)
+	})
+
+	t.Run("Should reject characters outside of the charset", func(t *testing.T) {
+		for _, key := range []string{"order 1", "order/1", "заказ", "order\n"} {
+			assertInvalidKey(urlSafe.Validate(key), t)
+		}
+	})
+
+	t.Run("Should reject invalid UTF-8", func(t *testing.T) {
+		assertInvalidKey(urlSafe.Validate("order-\xff"), t)
+	})
+
+	t.Run("Should be case-sensitive", func(t *testing.T) {
+		assertInvalidKey(crockford.Validate("01arz3ndektsv4rrffq69g5fav"), t)
+	})
+
+	t.Run("Should reject letters excluded from Crockford's alphabet",
+		func(t *testing.T) {
+			for _, key := range []string{"I", "L", "O", "U"} {
+				assertInvalidKey(crockford.Validate(key), t)
+			}
+		})
+}
+
+func TestULIDKey(t *testing.T) {
+	validator := ULIDKey()
+
+	t.Run("Should accept ULIDs", func(t *testing.T) {
+		for _, key := range []string{
+			"01ARZ3NDEKTSV4RRFFQ69G5FAV",
+			"00000000000000000000000000",
+			"7ZZZZZZZZZZZZZZZZZZZZZZZZZ",
+		} {
+			assertfatal.EqualError(validator.Validate(key), nil, t)
+		}
+	})
+
+	t.Run("Should accept lowercase ULIDs", func(t *testing.T) {
+		assertfatal.EqualError(validator.Validate("01arz3ndektsv4rrffq69g5fav"),
+			nil, t)
+	})
+
+	t.Run("Should reject keys of another length", func(t *testing.T) {
+		for _, key := range []string{
+			"",
+			"01ARZ3NDEKTSV4RRFFQ69G5FA",
+			"01ARZ3NDEKTSV4RRFFQ69G5FAVV",
+		} {
+			assertInvalidKey(validator.Validate(key), t)
+		}
+	})
+
+	t.Run("Should reject letters excluded from Crockford's alphabet",
+		func(t *testing.T) {
+			for _, key := range []string{
+				"01ARZ3NDEKTSV4RRFFQ69G5FAI",
+				"01ARZ3NDEKTSV4RRFFQ69G5FAL",
+				"01ARZ3NDEKTSV4RRFFQ69G5FAO",
+				"01ARZ3NDEKTSV4RRFFQ69G5FAU",
+				"01arz3ndektsv4rrffq69g5fau",
+			} {
+				assertInvalidKey(validator.Validate(key), t)
+			}
+		})
+
+	t.Run("Should reject other characters", func(t *testing.T) {
+		for _, key := range []string{
+			"01ARZ3NDEKTSV4RRFFQ69G5FA-",
+			"01ARZ3NDEKTSV4RRFFQ69G5FA\xff",
+		} {
+			assertInvalidKey(validator.Validate(key), t)
+		}
+	})
+
+	t.Run("Should reject timestamps overflowing 48 bits", func(t *testing.T) {
+		for _, key := range []string{
+			"80000000000000000000000000",
+			"ZZZZZZZZZZZZZZZZZZZZZZZZZZ",
+			"zzzzzzzzzzzzzzzzzzzzzzzzzz",
+		} {
+			assertInvalidKey(validator.Validate(key), t)
+		}
+	})
+}
+
+func assertInvalidKey(err error, t *testing.T) {
+	t.Helper()
+	assertfatal.Equal(errors.Is(err, ErrInvalidIdempotencyKey), true, t)
+}
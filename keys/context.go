@@ -0,0 +1,41 @@
+package keys
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// ErrNoKey is returned by Wrap when the context doesn't carry an idempotency
+// key.
+var ErrNoKey = errors.New(idempo.ErrorPrefix + "no idempotency key in context")
+
+type keyCtxKey struct{}
+
+// WithKey returns a copy of ctx that carries the idempotency key.
+func WithKey(ctx context.Context, idempotencyKey string) context.Context {
+	return context.WithValue(ctx, keyCtxKey{}, idempotencyKey)
+}
+
+// FromContext returns the idempotency key carried by ctx, if any.
+func FromContext(ctx context.Context) (idempotencyKey string, ok bool) {
+	idempotencyKey, ok = ctx.Value(keyCtxKey{}).(string)
+	return
+}
+
+// Wrap calls wrapper.Wrap with the idempotency key carried by ctx, so the key
+// doesn't have to be threaded through every function signature. Returns
+// ErrNoKey if there is no key.
+func Wrap[T idempo.UOWRepos, I idempo.Hasher, S, F any](ctx context.Context,
+	wrapper idempo.Wrapper[T, I, S, F],
+	input I,
+	action idempo.Action[T, I, S],
+) (successOutput S, err error) {
+	idempotencyKey, ok := FromContext(ctx)
+	if !ok {
+		err = ErrNoKey
+		return
+	}
+	return wrapper.Wrap(ctx, idempotencyKey, input, action)
+}
@@ -0,0 +1,38 @@
+package keys
+
+import (
+	"context"
+	"testing"
+
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+func TestContext(t *testing.T) {
+	t.Run("Should round-trip the key", func(t *testing.T) {
+		ctx := WithKey(context.Background(), "key-123")
+		key, ok := FromContext(ctx)
+		assertfatal.Equal(ok, true, t)
+		assertfatal.Equal(key, "key-123", t)
+	})
+
+	t.Run("Should report missing key", func(t *testing.T) {
+		_, ok := FromContext(context.Background())
+		assertfatal.Equal(ok, false, t)
+	})
+
+	t.Run("Wrap should fail without key", func(t *testing.T) {
+		var wrapper idempo.Wrapper[repos, hasher, string, string]
+		_, err := Wrap(context.Background(), wrapper, hasher("input"),
+			func(ctx context.Context, repos repos, idempotencyKey string,
+				input hasher,
+			) (string, error) {
+				return "", nil
+			})
+		assertfatal.EqualError(err, ErrNoKey, t)
+	})
+}
+
+type repos struct{}
+
+func (repos) IdempotencyStore() idempo.Store { return nil }
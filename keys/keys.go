@@ -0,0 +1,95 @@
+package keys
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// NewUUIDv7 generates a new time-ordered UUIDv7 key.
+func NewUUIDv7() (key string, err error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return
+	}
+	return id.String(), nil
+}
+
+// NewULID generates a new ULID key: a 48-bit millisecond timestamp followed by
+// 80 random bits, encoded with Crockford's base32.
+//
+// Keys generated within the same millisecond are monotonic: instead of new
+// random bits, they get the random bits of the previous key incremented by
+// one.
+func NewULID() (key string, err error) {
+	bs, err := ulids.next(uint64(time.Now().UnixMilli()))
+	if err != nil {
+		return
+	}
+	return encodeULID(bs), nil
+}
+
+// Derive returns a deterministic UUIDv5 key computed from the namespace and
+// the hasher output.
+//
+// It allows to derive keys from natural keys, e.g. an order number, so the
+// same business operation always gets the same idempotency key.
+func Derive(namespace uuid.UUID, hasher idempo.Hasher) (key string, err error) {
+	hash, err := hasher.Hash()
+	if err != nil {
+		return
+	}
+	return uuid.NewSHA1(namespace, []byte(hash)).String(), nil
+}
+
+var ulids ulidGenerator
+
+// ulidGenerator keeps the last generated ULID, so the next one is monotonic.
+type ulidGenerator struct {
+	mu   sync.Mutex
+	last [16]byte
+}
+
+// next returns the ULID with the given timestamp, or, if it isn't after the
+// timestamp of the last ULID (e.g. the clock went backwards), the last ULID
+// incremented by one.
+func (g *ulidGenerator) next(ms uint64) (bs [16]byte, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if ms > binary.BigEndian.Uint64(g.last[:8])>>16 {
+		binary.BigEndian.PutUint64(bs[:8], ms<<16)
+		if _, err = rand.Read(bs[6:]); err != nil {
+			return
+		}
+	} else {
+		// The carry of the random part overflows into the timestamp, so the
+		// order is kept even then.
+		bs = g.last
+		for i := len(bs) - 1; i >= 0; i-- {
+			if bs[i]++; bs[i] != 0 {
+				break
+			}
+		}
+	}
+	g.last = bs
+	return
+}
+
+func encodeULID(bs [16]byte) string {
+	var (
+		hi  = binary.BigEndian.Uint64(bs[:8])
+		lo  = binary.BigEndian.Uint64(bs[8:])
+		str [26]byte
+	)
+	// 26 characters encode 130 bits, the 2 most significant ones are always 0.
+	for i := len(str) - 1; i >= 0; i-- {
+		str[i] = idempo.CrockfordCharset[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(str[:])
+}
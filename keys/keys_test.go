@@ -0,0 +1,84 @@
+package keys
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+func TestNewULID(t *testing.T) {
+	t.Run("Should pass ULIDKey validation", func(t *testing.T) {
+		key, err := NewULID()
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.EqualError(idempo.ULIDKey().Validate(key), nil, t)
+	})
+
+	t.Run("Should be monotonic", func(t *testing.T) {
+		prev, err := NewULID()
+		assertfatal.EqualError(err, nil, t)
+		for range 10000 {
+			key, err := NewULID()
+			assertfatal.EqualError(err, nil, t)
+			assertfatal.Equal(key > prev, true, t)
+			prev = key
+		}
+	})
+
+	t.Run("Should be monotonic within a millisecond", func(t *testing.T) {
+		var g ulidGenerator
+		first, err := g.next(1000)
+		assertfatal.EqualError(err, nil, t)
+		second, err := g.next(1000)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(encodeULID(second) > encodeULID(first), true, t)
+		assertfatal.Equal([6]byte(second[:6]), [6]byte(first[:6]), t)
+
+		// The clock went backwards.
+		third, err := g.next(999)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(encodeULID(third) > encodeULID(second), true, t)
+	})
+
+	t.Run("Should carry overflow of random bits", func(t *testing.T) {
+		var g ulidGenerator
+		first, err := g.next(1000)
+		assertfatal.EqualError(err, nil, t)
+		for i := 6; i < len(g.last); i++ {
+			g.last[i] = 0xff
+		}
+		second, err := g.next(1000)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(encodeULID(second) > encodeULID(first), true, t)
+		assertfatal.Equal(second[5], first[5]+1, t)
+	})
+}
+
+func TestNewUUIDv7(t *testing.T) {
+	key, err := NewUUIDv7()
+	assertfatal.EqualError(err, nil, t)
+	assertfatal.EqualError(idempo.UUIDKey().Validate(key), nil, t)
+	assertfatal.Equal(uuid.MustParse(key).Version(), uuid.Version(7), t)
+}
+
+func TestDerive(t *testing.T) {
+	var (
+		namespace = uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+		order     = hasher("order-123")
+	)
+	key, err := Derive(namespace, order)
+	assertfatal.EqualError(err, nil, t)
+	same, err := Derive(namespace, order)
+	assertfatal.EqualError(err, nil, t)
+	other, err := Derive(namespace, hasher("order-456"))
+	assertfatal.EqualError(err, nil, t)
+	assertfatal.Equal(key, same, t)
+	assertfatal.Equal(key != other, true, t)
+}
+
+type hasher string
+
+func (h hasher) Hash() (string, error) {
+	return string(h), nil
+}
@@ -0,0 +1,220 @@
+package idempo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Lease configures leases on in-progress Records created by Wrapper.Submit.
+//
+// While the Action is executed, a heartbeat periodically extends the lease.
+// If the owner crashes, the lease expires and the execution can be taken over
+// by another Submit or Wrap call with the same idempotency key. Every takeover
+// increments the fencing token of the Record, so the previous owner, if it is
+// still alive, fails to save its outcome with ErrLeaseLost.
+//
+// Extending and taking over leases requires the Store to implement the
+// FencedStore interface, so every write made under a claim is a
+// compare-and-swap on the fencing token.
+//
+// The heartbeat runs in a UnitOfWork of its own. With UnitOfWorks that allow a
+// single writer at a time (e.g. uow/memdb or uow/fs), it waits while the
+// Action's transaction is open. That's safe, since a takeover needs the same
+// writer, and the waiting heartbeat is cancelled once the execution completes.
+type Lease struct {
+	// OwnerID identifies the process holding leases. Optional, if empty, a
+	// random one is generated.
+	OwnerID string
+	// Duration for which a lease is held without a heartbeat. If 0, leases are
+	// disabled and in-progress Records never expire.
+	Duration time.Duration
+	// HeartbeatInterval defines how often the lease is extended. Optional, if
+	// 0, it equals Duration/3.
+	HeartbeatInterval time.Duration
+}
+
+// Claim describes the lease on an in-progress Record.
+type Claim struct {
+	Owner        string
+	ExpiresAt    time.Time
+	FencingToken uint64
+}
+
+func (l Lease) claim(fencingToken uint64) Claim {
+	claim := Claim{Owner: l.OwnerID, FencingToken: fencingToken}
+	if l.Duration > 0 {
+		claim.ExpiresAt = time.Now().Add(l.Duration)
+	}
+	return claim
+}
+
+func (l Lease) heartbeatInterval() time.Duration {
+	if l.HeartbeatInterval > 0 {
+		return l.HeartbeatInterval
+	}
+	return l.Duration / 3
+}
+
+// ClaimOf returns the claim under which the in-progress Record is held.
+func ClaimOf(record Record) Claim {
+	return Claim{
+		Owner:        record.LeaseOwner,
+		ExpiresAt:    record.LeaseExpiresAt,
+		FencingToken: record.FencingToken,
+	}
+}
+
+// Holds reports whether the Record is in progress and held under the claim.
+// FencedStore implementations can use it to check the condition of their
+// writes when those are atomic anyway, e.g. in single-writer transactions.
+func (c Claim) Holds(record Record) bool {
+	return record.InProgress && record.LeaseOwner == c.Owner &&
+		record.FencingToken == c.FencingToken
+}
+
+// takeOverLease takes over the in-progress Record if its lease has expired.
+// ok is false if the lease is still held or was taken over by another owner.
+func (w Wrapper[T, I, S, F]) takeOverLease(ctx context.Context, store Store,
+	key Key,
+) (claim Claim, ok bool, err error) {
+	record, err := store.Get(ctx, key.ID())
+	if err != nil || !record.LeaseExpired(time.Now()) {
+		return
+	}
+	fenced, isFenced := store.(FencedStore)
+	if !isFenced {
+		err = ErrStoreNotFenced
+		return
+	}
+	expired := ClaimOf(record)
+	claim = w.lease.claim(record.FencingToken + 1)
+	record.LeaseOwner = claim.Owner
+	record.LeaseExpiresAt = claim.ExpiresAt
+	record.FencingToken = claim.FencingToken
+	err = fenced.UpdateFenced(ctx, expired, record)
+	if errors.Is(err, ErrLeaseLost) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	ok = true
+	return
+}
+
+// takeOverExpired deletes the in-progress Record if its lease has expired, so
+// the Action can be executed synchronously. ok is false if the lease is still
+// held, was taken over by another owner or the Store doesn't implement the
+// FencedStore interface.
+func (w Wrapper[T, I, S, F]) takeOverExpired(ctx context.Context, store Store,
+	key Key,
+) (ok bool, err error) {
+	record, err := store.Get(ctx, key.ID())
+	if err != nil || !record.LeaseExpired(time.Now()) {
+		return
+	}
+	fenced, isFenced := store.(FencedStore)
+	if !isFenced {
+		return
+	}
+	err = fenced.DeleteFenced(ctx, ClaimOf(record), key.ID())
+	if errors.Is(err, ErrLeaseLost) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	ok = true
+	return
+}
+
+// checkFencingToken returns ErrLeaseLost if the in-progress Record is no longer
+// held under the claim. It spares the execution of an Action whose outcome
+// can't be saved, but doesn't replace the fenced write of the outcome.
+func checkFencingToken(ctx context.Context, store Store, key Key,
+	claim Claim,
+) (err error) {
+	record, err := store.Get(ctx, key.ID())
+	if errors.Is(err, ErrIdempotencyRecordNotFound) {
+		return ErrLeaseLost
+	}
+	if err != nil {
+		return
+	}
+	if !claim.Holds(record) {
+		return ErrLeaseLost
+	}
+	return
+}
+
+// claimedStore saves Records in place of the in-progress Record, only if it's
+// still held under the claim.
+type claimedStore struct {
+	FencedStore
+	Store
+	claim Claim
+}
+
+func (s claimedStore) Save(ctx context.Context, record Record) error {
+	return s.UpdateFenced(ctx, s.claim, record)
+}
+
+// heartbeat periodically extends the lease on the in-progress Record, each
+// time in a separate UnitOfWork, until the returned stop function is called
+// or the lease is lost. stop cancels an extension that is still waiting for
+// its UnitOfWork.
+func (w Wrapper[T, I, S, F]) heartbeat(ctx context.Context, key Key,
+	claim Claim,
+) (stop func()) {
+	if w.lease.Duration <= 0 {
+		return func() {}
+	}
+	var (
+		wg     sync.WaitGroup
+		ticker = time.NewTicker(w.lease.heartbeatInterval())
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := w.extendLease(ctx, key, claim); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func (w Wrapper[T, I, S, F]) extendLease(ctx context.Context, key Key,
+	claim Claim,
+) error {
+	return executeContext(ctx, w.unitOfWork, func(ctx context.Context,
+		repos T,
+	) (fnErr error) {
+		store := repos.IdempotencyStore()
+		fenced, ok := store.(FencedStore)
+		if !ok {
+			return ErrStoreNotFenced
+		}
+		record, fnErr := store.Get(ctx, key.ID())
+		if fnErr != nil {
+			return
+		}
+		record.LeaseExpiresAt = time.Now().Add(w.lease.Duration)
+		return fenced.UpdateFenced(ctx, claim, record)
+	})
+}
@@ -0,0 +1,225 @@
+package idempo_test
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"testing"
+	"time"
+
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+func TestLease(t *testing.T) {
+	var (
+		db   = newDB()
+		pool = idempo.NewWorkerPool(1, 10)
+		conf = newConf(newUnitOfWork(db))
+	)
+	defer pool.Close()
+	conf.WorkerPool = pool
+	conf.Lease = idempo.Lease{OwnerID: "worker-2", Duration: time.Second}
+	var (
+		wrapper      = idempo.NewWrapper[repos, transferInput](conf)
+		input        = transferInput{FromAccount: "A", ToAccount: "B", Amount: 100}
+		inputHash, _ = input.Hash()
+	)
+
+	t.Run("Should not take over a held lease", func(t *testing.T) {
+		putRecord(db, idempo.Record{
+			ID:             "transfer-123",
+			InputHash:      inputHash,
+			InProgress:     true,
+			LeaseOwner:     "worker-1",
+			LeaseExpiresAt: time.Now().Add(time.Hour),
+			FencingToken:   1,
+		})
+		handle, err := wrapper.Submit(context.TODO(), "transfer-123", input,
+			transfer)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(handle.Accepted, false, t)
+
+		_, err = wrapper.Wrap(context.TODO(), "transfer-123", input, transfer)
+		assertfatal.EqualError(err, idempo.ErrInProgress, t)
+	})
+
+	t.Run("Submit should take over an expired lease", func(t *testing.T) {
+		putRecord(db, idempo.Record{
+			ID:             "transfer-123",
+			InputHash:      inputHash,
+			InProgress:     true,
+			LeaseOwner:     "worker-1",
+			LeaseExpiresAt: time.Now().Add(-time.Second),
+			FencingToken:   1,
+		})
+		handle, err := wrapper.Submit(context.TODO(), "transfer-123", input,
+			transfer)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(handle.Accepted, true, t)
+
+		execution := awaitExecution(t, wrapper, "transfer-123")
+		assertfatal.Equal(execution.Status, idempo.StatusSucceeded, t)
+		assertfatal.Equal(getBalance(db, input.FromAccount), 900, t)
+	})
+
+	t.Run("Wrap should take over an expired lease", func(t *testing.T) {
+		putRecord(db, idempo.Record{
+			ID:             "transfer-456",
+			InputHash:      inputHash,
+			InProgress:     true,
+			LeaseOwner:     "worker-1",
+			LeaseExpiresAt: time.Now().Add(-time.Second),
+			FencingToken:   1,
+		})
+		result, err := wrapper.Wrap(context.TODO(), "transfer-456", input,
+			transfer)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(isUUID(result.TransactionID), true, t)
+		assertfatal.Equal(getRecord(db, "transfer-456").InProgress, false, t)
+		assertfatal.Equal(getBalance(db, input.FromAccount), 800, t)
+	})
+}
+
+// TestStaleClaim checks that an owner, whose lease was taken over while it
+// executed the Action, can't overwrite the Record of the new owner, even if
+// the Store reads from a snapshot taken before the takeover.
+func TestStaleClaim(t *testing.T) {
+	var (
+		unitOfWork = newSnapshotUnitOfWork()
+		pool       = idempo.NewWorkerPool(1, 10)
+		conf       = newConf(unitOfWork)
+	)
+	conf.WorkerPool = pool
+	conf.Lease = idempo.Lease{OwnerID: "worker-1", Duration: time.Hour}
+	var (
+		wrapper = idempo.NewWrapper[repos, transferInput](conf)
+		taken   idempo.Record
+		calls   int
+		action  = func(ctx context.Context, repos repos, idempotencyKey string,
+			input transferInput,
+		) (result transferSuccess, err error) {
+			calls++
+			// Another owner takes over the lease while the Action is executed.
+			taken = unitOfWork.get(idempotencyKey)
+			taken.LeaseOwner = "worker-2"
+			taken.FencingToken++
+			unitOfWork.put(taken)
+			result.TransactionID = "transaction-1"
+			return
+		}
+		input = transferInput{FromAccount: "A", ToAccount: "B", Amount: 1}
+	)
+	handle, err := wrapper.Submit(context.TODO(), "transfer-123", input, action)
+	assertfatal.EqualError(err, nil, t)
+	assertfatal.Equal(handle.Accepted, true, t)
+	pool.Close()
+
+	assertfatal.Equal(calls, 1, t)
+	record := unitOfWork.get("transfer-123")
+	assertfatal.Equal(record.InProgress, true, t)
+	assertfatal.Equal(record.LeaseOwner, taken.LeaseOwner, t)
+	assertfatal.Equal(record.FencingToken, taken.FencingToken, t)
+	execution, err := wrapper.Status(context.TODO(), "transfer-123")
+	assertfatal.EqualError(err, nil, t)
+	assertfatal.Equal(execution.Status, idempo.StatusPending, t)
+}
+
+func newSnapshotUnitOfWork() *snapshotUnitOfWork {
+	return &snapshotUnitOfWork{committed: map[string]idempo.Record{}}
+}
+
+// snapshotUnitOfWork emulates snapshot isolation: the Store reads from the
+// snapshot of the records taken when the transaction starts, and its writes
+// are applied on commit. Fenced writes are checked against the committed
+// records on commit, which fails with ErrLeaseLost if any of them doesn't
+// match.
+type snapshotUnitOfWork struct {
+	mu        sync.Mutex
+	committed map[string]idempo.Record
+}
+
+func (u *snapshotUnitOfWork) Execute(fn func(repos repos) error) error {
+	u.mu.Lock()
+	store := &snapshotStore{
+		snapshot: maps.Clone(u.committed),
+		claims:   map[string]idempo.Claim{},
+		writes:   map[string]*idempo.Record{},
+	}
+	u.mu.Unlock()
+	if err := fn(repos{store: store}); err != nil {
+		return err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for id, claim := range store.claims {
+		record, ok := u.committed[id]
+		if !ok || !claim.Holds(record) {
+			return idempo.ErrLeaseLost
+		}
+	}
+	for id, record := range store.writes {
+		if record == nil {
+			delete(u.committed, id)
+		} else {
+			u.committed[id] = *record
+		}
+	}
+	return nil
+}
+
+func (u *snapshotUnitOfWork) get(id string) idempo.Record {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.committed[id]
+}
+
+func (u *snapshotUnitOfWork) put(record idempo.Record) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.committed[record.ID] = record
+}
+
+type snapshotStore struct {
+	snapshot map[string]idempo.Record
+	claims   map[string]idempo.Claim
+	// writes holds nil for the deleted records.
+	writes map[string]*idempo.Record
+}
+
+func (s *snapshotStore) Get(ctx context.Context, id string) (
+	record idempo.Record, err error,
+) {
+	if w, ok := s.writes[id]; ok {
+		if w == nil {
+			return record, idempo.ErrIdempotencyRecordNotFound
+		}
+		return *w, nil
+	}
+	record, ok := s.snapshot[id]
+	if !ok {
+		err = idempo.ErrIdempotencyRecordNotFound
+	}
+	return
+}
+
+func (s *snapshotStore) Save(ctx context.Context, record idempo.Record) error {
+	s.writes[record.ID] = &record
+	return nil
+}
+
+func (s *snapshotStore) UpdateFenced(ctx context.Context, claim idempo.Claim,
+	record idempo.Record,
+) error {
+	s.claims[record.ID] = claim
+	s.writes[record.ID] = &record
+	return nil
+}
+
+func (s *snapshotStore) DeleteFenced(ctx context.Context, claim idempo.Claim,
+	id string,
+) error {
+	s.claims[id] = claim
+	s.writes[id] = nil
+	return nil
+}
@@ -0,0 +1,66 @@
+package idempo
+
+import (
+	"context"
+	"slices"
+)
+
+// Unlock releases a lock acquired with the Locker.
+type Unlock func() error
+
+// Locker acquires per-key locks. It allows using Stores without transactions,
+// for which the UnitOfWork can't prevent concurrent executions with the same
+// idempotency key.
+//
+// Lock blocks until the lock for the key is acquired or ctx is done.
+//
+// The Wrapper ignores errors returned by Unlock, since the outcome of the
+// execution has already been saved by then. Distributed implementations
+// should therefore let locks expire.
+//
+// WrapBatch acquires the locks of its Items in the sorted order of their keys,
+// so concurrent batches can't deadlock. Locks are not expected to be
+// reentrant, so an Action must not call Wrap with its own idempotency key.
+type Locker interface {
+	Lock(ctx context.Context, key string) (Unlock, error)
+}
+
+// lock acquires the lock for the key with the Locker from the Config, if any.
+func (w Wrapper[T, I, S, F]) lock(ctx context.Context, key Key) (
+	unlock func(), err error,
+) {
+	if w.locker == nil {
+		return func() {}, nil
+	}
+	u, err := w.locker.Lock(ctx, key.ID())
+	if err != nil {
+		return
+	}
+	return func() { u() }, nil
+}
+
+// lockAll acquires the locks for the keys with the given IDs in sorted order,
+// with the Locker from the Config, if any.
+func (w Wrapper[T, I, S, F]) lockAll(ctx context.Context, ids []string) (
+	unlock func(), err error,
+) {
+	if w.locker == nil {
+		return func() {}, nil
+	}
+	ids = slices.Compact(slices.Sorted(slices.Values(ids)))
+	unlocks := make([]Unlock, 0, len(ids))
+	unlock = func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+	for _, id := range ids {
+		u, err := w.locker.Lock(ctx, id)
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+		unlocks = append(unlocks, u)
+	}
+	return
+}
@@ -0,0 +1,80 @@
+package lockertest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// TestLocker checks that the Locker provides mutual exclusion per key, respects
+// context cancellation and can be re-acquired after unlock.
+func TestLocker(t *testing.T, locker idempo.Locker) {
+	t.Run("Should provide mutual exclusion", func(t *testing.T) {
+		var (
+			wg       sync.WaitGroup
+			inFlight atomic.Int32
+			overlaps atomic.Int32
+			counter  int
+			errs     = make(chan error, 10)
+		)
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 20 {
+					unlock, err := locker.Lock(context.Background(), "mutex-key")
+					if err != nil {
+						errs <- err
+						return
+					}
+					if inFlight.Add(1) > 1 {
+						overlaps.Add(1)
+					}
+					counter++
+					inFlight.Add(-1)
+					if err = unlock(); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			assertfatal.EqualError(err, nil, t)
+		}
+		assertfatal.Equal(overlaps.Load(), int32(0), t)
+		assertfatal.Equal(counter, 200, t)
+	})
+
+	t.Run("Should respect context while waiting", func(t *testing.T) {
+		unlock, err := locker.Lock(context.Background(), "ctx-key")
+		assertfatal.EqualError(err, nil, t)
+		defer unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(),
+			50*time.Millisecond)
+		defer cancel()
+		_, err = locker.Lock(ctx, "ctx-key")
+		assertfatal.Equal(errors.Is(err, context.DeadlineExceeded), true, t)
+	})
+
+	t.Run("Should be re-acquired after unlock", func(t *testing.T) {
+		unlock, err := locker.Lock(context.Background(), "relock-key")
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.EqualError(unlock(), nil, t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		unlock, err = locker.Lock(ctx, "relock-key")
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.EqualError(unlock(), nil, t)
+	})
+}
@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"context"
+	"hash/maphash"
+	"sync"
+
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// DefaultStripes is the default number of stripes of the Locker.
+const DefaultStripes = 256
+
+// NewLocker creates a new Locker with the given number of stripes. A number
+// <= 0 means DefaultStripes.
+func NewLocker(stripes int) *Locker {
+	if stripes <= 0 {
+		stripes = DefaultStripes
+	}
+	l := &Locker{seed: maphash.MakeSeed(), stripes: make([]stripe, stripes)}
+	for i := range l.stripes {
+		l.stripes[i].locks = make(map[string]*lock)
+	}
+	return l
+}
+
+// Locker is an idempo.Locker that keeps per-key locks in a fixed set of
+// stripes, each guarded by a mutex of its own, so concurrent Lock calls with
+// different keys rarely contend. A lock only occupies memory while it is held
+// or awaited, and keys sharing a stripe never wait for each other.
+//
+// Locks are not reentrant: locking a key already held by the caller, e.g. with
+// a nested Wrap call with the same idempotency key, waits until ctx is done.
+//
+// It only synchronizes executions within a single process.
+type Locker struct {
+	seed    maphash.Seed
+	stripes []stripe
+}
+
+type stripe struct {
+	mu    sync.Mutex
+	locks map[string]*lock
+}
+
+// lock is the lock of a key, refs counts its holder and waiters.
+type lock struct {
+	held chan struct{}
+	refs int
+}
+
+func (l *Locker) Lock(ctx context.Context, key string) (unlock idempo.Unlock,
+	err error,
+) {
+	s := &l.stripes[maphash.String(l.seed, key)%uint64(len(l.stripes))]
+	s.mu.Lock()
+	lk, ok := s.locks[key]
+	if !ok {
+		lk = &lock{held: make(chan struct{}, 1)}
+		s.locks[key] = lk
+	}
+	lk.refs++
+	s.mu.Unlock()
+	select {
+	case lk.held <- struct{}{}:
+	case <-ctx.Done():
+		s.release(key, lk)
+		return nil, ctx.Err()
+	}
+	var once sync.Once
+	return func() error {
+		once.Do(func() {
+			<-lk.held
+			s.release(key, lk)
+		})
+		return nil
+	}, nil
+}
+
+// release drops the reference to the lock, and removes it once there are no
+// references left.
+func (s *stripe) release(key string, lk *lock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if lk.refs--; lk.refs == 0 {
+		delete(s.locks, key)
+	}
+}
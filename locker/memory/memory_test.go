@@ -0,0 +1,53 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go/locker/lockertest"
+)
+
+func TestLocker(t *testing.T) {
+	lockertest.TestLocker(t, NewLocker(0))
+
+	t.Run("Keys sharing a stripe should not wait for each other",
+		func(t *testing.T) {
+			locker := NewLocker(1)
+			unlock, err := locker.Lock(context.Background(), "key-1")
+			assertfatal.EqualError(err, nil, t)
+			defer unlock()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			unlock, err = locker.Lock(ctx, "key-2")
+			assertfatal.EqualError(err, nil, t)
+			assertfatal.EqualError(unlock(), nil, t)
+		})
+
+	t.Run("Should not be reentrant", func(t *testing.T) {
+		locker := NewLocker(0)
+		unlock, err := locker.Lock(context.Background(), "key")
+		assertfatal.EqualError(err, nil, t)
+		defer unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(),
+			50*time.Millisecond)
+		defer cancel()
+		_, err = locker.Lock(ctx, "key")
+		assertfatal.EqualError(err, context.DeadlineExceeded, t)
+	})
+
+	t.Run("Should remove released locks", func(t *testing.T) {
+		locker := NewLocker(1)
+		unlock, err := locker.Lock(context.Background(), "key")
+		assertfatal.EqualError(err, nil, t)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = locker.Lock(ctx, "key")
+		assertfatal.EqualError(err, context.Canceled, t)
+		assertfatal.EqualError(unlock(), nil, t)
+		assertfatal.Equal(len(locker.stripes[0].locks), 0, t)
+	})
+}
@@ -0,0 +1,23 @@
+module github.com/ymz-ncnk/idempo-go/locker/postgres
+
+go 1.24.1
+
+require (
+	github.com/jackc/pgx/v5 v5.7.5
+	github.com/ymz-ncnk/idempo-go v0.0.0-00010101000000-000000000000
+)
+
+require (
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
+	github.com/jackc/puddle/v2 v2.2.2 // indirect
+	github.com/stretchr/testify v1.9.0 // indirect
+	github.com/ymz-ncnk/assert v0.0.0-20250528151733-c41b2fca7933 // indirect
+	golang.org/x/crypto v0.37.0 // indirect
+	golang.org/x/exp v0.0.0-20251023183803-a4bb9ffd2546 // indirect
+	golang.org/x/sync v0.17.0 // indirect
+	golang.org/x/text v0.24.0 // indirect
+)
+
+replace github.com/ymz-ncnk/idempo-go => ../..
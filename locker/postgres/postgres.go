@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// NewLocker creates a new Locker.
+func NewLocker(db *sql.DB) Locker {
+	return Locker{db}
+}
+
+// Locker is an idempo.Locker that uses session-level PostgreSQL advisory
+// locks. Keys are mapped to lock IDs with the 64-bit FNV-1a hash.
+//
+// Each held lock occupies a connection of the pool until it is released. If
+// the process crashes, the lock is released together with the session.
+type Locker struct {
+	db *sql.DB
+}
+
+func (l Locker) Lock(ctx context.Context, key string) (unlock idempo.Unlock,
+	err error,
+) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return
+	}
+	id := lockID(key)
+	if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", id); err != nil {
+		discard(conn)
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return
+	}
+	return func() (err error) {
+		_, err = conn.ExecContext(context.Background(),
+			"SELECT pg_advisory_unlock($1)", id)
+		if err != nil {
+			// The session can still hold the lock, so it must not be reused.
+			discard(conn)
+			return fmt.Errorf(idempo.ErrorPrefix+"postgres unlock error: %w", err)
+		}
+		return conn.Close()
+	}, nil
+}
+
+func lockID(key string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return int64(h.Sum64())
+}
+
+// discard closes the connection instead of returning it to the pool.
+func discard(conn *sql.Conn) {
+	conn.Raw(func(any) error { return driver.ErrBadConn })
+	conn.Close()
+}
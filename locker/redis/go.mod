@@ -0,0 +1,21 @@
+module github.com/ymz-ncnk/idempo-go/locker/redis
+
+go 1.24.1
+
+require (
+	github.com/alicebob/miniredis/v2 v2.34.0
+	github.com/google/uuid v1.6.0
+	github.com/redis/go-redis/v9 v9.7.3
+	github.com/ymz-ncnk/idempo-go v0.0.0-00010101000000-000000000000
+)
+
+require (
+	github.com/alicebob/gopher-json v0.0.0-20230218143504-906a9b012302 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/ymz-ncnk/assert v0.0.0-20250528151733-c41b2fca7933 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+	golang.org/x/exp v0.0.0-20251023183803-a4bb9ffd2546 // indirect
+)
+
+replace github.com/ymz-ncnk/idempo-go => ../..
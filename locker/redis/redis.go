@@ -0,0 +1,113 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+const (
+	// DefaultKeyPrefix is the default prefix of the Redis keys that hold locks.
+	DefaultKeyPrefix = "idempo:lock:"
+	// DefaultTTL is the default period after which a lock expires, if it is
+	// not released.
+	DefaultTTL = 30 * time.Second
+	// DefaultRetryInterval is the default delay between attempts to acquire a
+	// lock held by someone else.
+	DefaultRetryInterval = 10 * time.Millisecond
+)
+
+// ErrLockNotHeld is returned by Unlock when the lock has expired and may have
+// been acquired by someone else.
+var ErrLockNotHeld = errors.New(idempo.ErrorPrefix + "redis lock not held")
+
+// unlockScript deletes the lock only if it still holds the owner's token.
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Config configures the Locker. Zero fields, except the Client, are replaced
+// with defaults.
+type Config struct {
+	Client redis.UniversalClient
+	// KeyPrefix is prepended to idempotency keys to form Redis keys.
+	KeyPrefix string
+	// TTL is the period after which a lock expires. It should exceed the
+	// execution time of the Action.
+	TTL time.Duration
+	// RetryInterval is the delay between attempts to acquire a lock held by
+	// someone else.
+	RetryInterval time.Duration
+}
+
+// NewLocker creates a new Locker.
+func NewLocker(conf Config) Locker {
+	if conf.KeyPrefix == "" {
+		conf.KeyPrefix = DefaultKeyPrefix
+	}
+	if conf.TTL <= 0 {
+		conf.TTL = DefaultTTL
+	}
+	if conf.RetryInterval <= 0 {
+		conf.RetryInterval = DefaultRetryInterval
+	}
+	return Locker{conf}
+}
+
+// Locker is an idempo.Locker that holds locks as Redis keys, set with NX and a
+// TTL to a random token of the owner. A lock is released only by its owner,
+// and expires if the owner crashes.
+type Locker struct {
+	conf Config
+}
+
+func (l Locker) Lock(ctx context.Context, key string) (unlock idempo.Unlock,
+	err error,
+) {
+	var (
+		redisKey = l.conf.KeyPrefix + key
+		token    = uuid.NewString()
+		ok       bool
+	)
+	for {
+		ok, err = l.conf.Client.SetNX(ctx, redisKey, token, l.conf.TTL).Result()
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+				return
+			}
+			err = fmt.Errorf(idempo.ErrorPrefix+"redis lock error: %w", err)
+			return
+		}
+		if ok {
+			break
+		}
+		timer := time.NewTimer(l.conf.RetryInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			err = ctx.Err()
+			return
+		case <-timer.C:
+		}
+	}
+	return func() error {
+		n, err := unlockScript.Run(context.Background(), l.conf.Client,
+			[]string{redisKey}, token).Int()
+		if err != nil {
+			return fmt.Errorf(idempo.ErrorPrefix+"redis unlock error: %w", err)
+		}
+		if n == 0 {
+			return ErrLockNotHeld
+		}
+		return nil
+	}, nil
+}
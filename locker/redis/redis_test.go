@@ -0,0 +1,16 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/ymz-ncnk/idempo-go/locker/lockertest"
+)
+
+func TestLocker(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	lockertest.TestLocker(t, NewLocker(Config{Client: client}))
+}
@@ -0,0 +1,95 @@
+package idempo_test
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+	"github.com/ymz-ncnk/idempo-go/locker/memory"
+)
+
+func TestLocker(t *testing.T) {
+	var (
+		locker = memory.NewLocker(0)
+		conf   = newConf(newUnitOfWork(newDB()))
+	)
+	conf.Locker = locker
+	var (
+		wrapper = idempo.NewWrapper[repos, transferInput](conf)
+		action  = func(ctx context.Context, repos repos, idempotencyKey string,
+			input transferInput,
+		) (result transferSuccess, err error) {
+			result.TransactionID = uuid.NewString()
+			return
+		}
+		input = transferInput{FromAccount: "A", ToAccount: "B", Amount: 1}
+	)
+
+	t.Run("Should wait for the lock", func(t *testing.T) {
+		unlock, err := locker.Lock(context.TODO(), "transfer-123")
+		assertfatal.EqualError(err, nil, t)
+		defer unlock()
+		ctx, cancel := context.WithTimeout(context.Background(),
+			50*time.Millisecond)
+		defer cancel()
+		_, err = wrapper.Wrap(ctx, "transfer-123", input, action)
+		assertfatal.EqualError(err, context.DeadlineExceeded, t)
+	})
+
+	t.Run("Should execute once the lock is released", func(t *testing.T) {
+		result, err := wrapper.Wrap(context.TODO(), "transfer-123", input, action)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(isUUID(result.TransactionID), true, t)
+	})
+
+	t.Run("WrapBatch should wait for the lock of any item", func(t *testing.T) {
+		unlock, err := locker.Lock(context.TODO(), "transfer-789")
+		assertfatal.EqualError(err, nil, t)
+		items := []idempo.Item[transferInput]{
+			{IdempotencyKey: "transfer-789", Input: input},
+			{IdempotencyKey: "transfer-456", Input: input},
+		}
+		ctx, cancel := context.WithTimeout(context.Background(),
+			50*time.Millisecond)
+		defer cancel()
+		_, err = wrapper.WrapBatch(ctx, items, action)
+		assertfatal.EqualError(err, context.DeadlineExceeded, t)
+
+		unlock()
+		results, err := wrapper.WrapBatch(context.TODO(), items, action)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(len(results), 2, t)
+	})
+
+	t.Run("Concurrent batches should not deadlock", func(t *testing.T) {
+		var (
+			wg    sync.WaitGroup
+			errs  = make([]error, 10)
+			items = []idempo.Item[transferInput]{
+				{IdempotencyKey: "transfer-a", Input: input},
+				{IdempotencyKey: "transfer-b", Input: input},
+				{IdempotencyKey: "transfer-c", Input: input},
+			}
+		)
+		for i := range errs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				items := slices.Clone(items)
+				if i%2 == 1 {
+					slices.Reverse(items)
+				}
+				_, errs[i] = wrapper.WrapBatch(context.TODO(), items, action)
+			}()
+		}
+		wg.Wait()
+		for _, err := range errs {
+			assertfatal.EqualError(err, nil, t)
+		}
+	})
+}
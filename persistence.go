@@ -0,0 +1,44 @@
+package idempo
+
+import "time"
+
+// Persistence defines whether, and for how long, the failure output of an
+// Action is persisted.
+type Persistence struct {
+	persist bool
+	ttl     time.Duration
+}
+
+var (
+	// PersistNone means the failure output is not persisted, so a retry
+	// re-runs the Action. Suitable for system errors (e.g. context deadline
+	// exceeded, database connection loss).
+	PersistNone = Persistence{}
+	// PersistPermanent means the failure output is persisted forever, so all
+	// retries receive the same error. Suitable for business failures (e.g.
+	// insufficient funds).
+	PersistPermanent = Persistence{persist: true}
+)
+
+// PersistFor means the failure output is persisted for the given period.
+// Retries made within it receive the same error, while later ones re-run the
+// Action. Suitable for transient failures (e.g. downstream rate limited).
+//
+// A non-positive ttl is equivalent to PersistNone.
+func PersistFor(ttl time.Duration) Persistence {
+	if ttl <= 0 {
+		return PersistNone
+	}
+	return Persistence{persist: true, ttl: ttl}
+}
+
+// Persist reports whether the failure output should be persisted.
+func (p Persistence) Persist() bool {
+	return p.persist
+}
+
+// TTL returns the period for which the failure output should be persisted, 0
+// if permanently.
+func (p Persistence) TTL() time.Duration {
+	return p.ttl
+}
@@ -0,0 +1,58 @@
+package idempo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+func TestTransientFailure(t *testing.T) {
+	var (
+		errRateLimited = errors.New("rate limited")
+		ttl            = 50 * time.Millisecond
+		conf           = newConf(newUnitOfWork(newDB()))
+	)
+	conf.FailureToError = func(failure transferFailure) error {
+		return errRateLimited
+	}
+	conf.ErrorToFailure = func(err error) (idempo.Persistence, transferFailure) {
+		return idempo.PersistFor(ttl), transferFailure{Reason: err.Error()}
+	}
+	var (
+		wrapper = idempo.NewWrapper[repos, transferInput](conf)
+		calls   int
+		action  = func(ctx context.Context, repos repos, idempotencyKey string,
+			input transferInput,
+		) (result transferSuccess, err error) {
+			if calls++; calls == 1 {
+				err = errRateLimited
+				return
+			}
+			result.TransactionID = uuid.NewString()
+			return
+		}
+		idempotencyKey = "transfer-123"
+		input          = transferInput{FromAccount: "A", ToAccount: "B", Amount: 1}
+	)
+	_, err := wrapper.Wrap(context.TODO(), idempotencyKey, input, action)
+	assertfatal.EqualError(err, errRateLimited, t)
+
+	t.Run("Should return cached failure before it expires", func(t *testing.T) {
+		_, err := wrapper.Wrap(context.TODO(), idempotencyKey, input, action)
+		assertfatal.EqualError(err, errRateLimited, t)
+		assertfatal.Equal(calls, 1, t)
+	})
+
+	t.Run("Should re-run Action after failure expires", func(t *testing.T) {
+		time.Sleep(ttl)
+		result, err := wrapper.Wrap(context.TODO(), idempotencyKey, input, action)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(isUUID(result.TransactionID), true, t)
+		assertfatal.Equal(calls, 2, t)
+	})
+}
@@ -1,9 +1,44 @@
 package idempo
 
+import "time"
+
 // Record holds the Action output.
 type Record struct {
 	ID            string
 	InputHash     string
 	SuccessOutput bool
 	Output        []byte
+	// SchemaVersion is the schema version of the Output, as reported by a
+	// VersionedSerializer. It is 0 for outputs produced by a regular
+	// Serializer.
+	SchemaVersion int
+	// Scope is the scope of the idempotency key (see KeyScope).
+	Scope string
+	// ExpiresAt is the time after which the Record is ignored and the Action
+	// can be re-run. Zero if the Record never expires.
+	ExpiresAt time.Time
+	// InProgress marks a Record of an execution that has been accepted, but
+	// not yet completed (see Wrapper.Submit). Such a Record has no Output.
+	InProgress bool
+	// LeaseOwner identifies the process holding the lease on the in-progress
+	// Record.
+	LeaseOwner string
+	// LeaseExpiresAt is the time after which the lease on the in-progress
+	// Record can be taken over. Zero if the lease never expires.
+	LeaseExpiresAt time.Time
+	// FencingToken is incremented each time the lease on the in-progress
+	// Record is taken over. It prevents a stale owner from saving the outcome.
+	FencingToken uint64
+}
+
+// Expired reports whether the Record has expired at the given time.
+func (r Record) Expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt)
+}
+
+// LeaseExpired reports whether the Record is in progress and its lease has
+// expired at the given time.
+func (r Record) LeaseExpired(now time.Time) bool {
+	return r.InProgress && !r.LeaseExpiresAt.IsZero() &&
+		!now.Before(r.LeaseExpiresAt)
 }
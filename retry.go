@@ -0,0 +1,121 @@
+package idempo
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+const (
+	// DefaultRetryMaxAttempts is the default maximum number of UnitOfWork
+	// attempts, including the first one.
+	DefaultRetryMaxAttempts = 3
+	// DefaultRetryInitialBackoff is the default delay before the first retry.
+	DefaultRetryInitialBackoff = 10 * time.Millisecond
+	// DefaultRetryMaxBackoff is the default upper bound of the delay between
+	// retries.
+	DefaultRetryMaxBackoff = time.Second
+)
+
+// PostgresClassifier classifies PostgreSQL serialization failures (40001) and
+// detected deadlocks (40P01) as retryable.
+var PostgresClassifier = SQLStateClassifier{"40001", "40P01"}
+
+// RetryClassifier decides whether an error returned by the UnitOfWork is
+// transient, e.g. a serialization failure or a deadlock, so the whole
+// UnitOfWork can be retried. It is usually implemented by the backend.
+type RetryClassifier interface {
+	Retryable(err error) bool
+}
+
+// RetryClassifierFunc is a function that implements the RetryClassifier
+// interface.
+type RetryClassifierFunc func(err error) bool
+
+func (f RetryClassifierFunc) Retryable(err error) bool {
+	return f(err)
+}
+
+// SQLStateClassifier is a RetryClassifier that classifies errors by their
+// SQLSTATE code. It recognizes errors in the chain with the SQLState() string
+// method, like *pgconn.PgError of pgx or *pq.Error of lib/pq.
+type SQLStateClassifier []string
+
+func (c SQLStateClassifier) Retryable(err error) bool {
+	var sqlErr interface{ SQLState() string }
+	if !errors.As(err, &sqlErr) {
+		return false
+	}
+	return slices.Contains(c, sqlErr.SQLState())
+}
+
+// RetryPolicy defines how the Wrapper retries a UnitOfWork that has failed
+// with a transient error.
+//
+// The whole UnitOfWork, i.e. the idempotency check, the Action and saving of
+// its output, is retried, so side effects of the Action outside of the
+// UnitOfWork can be repeated.
+//
+// Zero fields, except the Classifier, are replaced with defaults.
+type RetryPolicy struct {
+	// Classifier decides which errors are retried. If nil, retries are
+	// disabled.
+	Classifier RetryClassifier
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry. It doubles with each
+	// subsequent retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between retries.
+	MaxBackoff time.Duration
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryMaxBackoff
+	}
+	return p
+}
+
+// Backoff returns the delay before the retry that follows the given attempt:
+// InitialBackoff doubled with each attempt and capped by MaxBackoff, with
+// full jitter.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := p.MaxBackoff
+	if shift := attempt - 1; shift < 32 {
+		if exp := p.InitialBackoff << shift; exp > 0 && exp < backoff {
+			backoff = exp
+		}
+	}
+	return rand.N(backoff) + 1
+}
+
+// executeUnitOfWork executes fn within the UnitOfWork, retrying it according
+// to the RetryPolicy. fn must not keep state between attempts.
+func (w Wrapper[T, I, S, F]) executeUnitOfWork(ctx context.Context,
+	fn func(ctx context.Context, repos T) error,
+) (err error) {
+	for attempt := 1; ; attempt++ {
+		err = executeContext(ctx, w.unitOfWork, fn)
+		if err == nil || w.retryPolicy.Classifier == nil ||
+			attempt >= w.retryPolicy.MaxAttempts ||
+			!w.retryPolicy.Classifier.Retryable(err) {
+			return
+		}
+		timer := time.NewTimer(w.retryPolicy.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package idempo_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	conf := newConf(newUnitOfWork(newDB()))
+	conf.RetryPolicy = idempo.RetryPolicy{
+		Classifier:     idempo.PostgresClassifier,
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	}
+	var (
+		wrapper = idempo.NewWrapper[repos, transferInput](conf)
+		calls   int
+		// failures is the number of calls that fail with a serialization
+		// failure.
+		failures int
+		action   = func(ctx context.Context, repos repos, idempotencyKey string,
+			input transferInput,
+		) (result transferSuccess, err error) {
+			if calls++; calls <= failures {
+				err = fmt.Errorf("commit: %w", sqlStateError("40001"))
+				return
+			}
+			result.TransactionID = uuid.NewString()
+			return
+		}
+		input = transferInput{FromAccount: "A", ToAccount: "B", Amount: 1}
+	)
+
+	t.Run("Should retry the unit of work", func(t *testing.T) {
+		calls, failures = 0, 2
+		result, err := wrapper.Wrap(context.TODO(), "transfer-123", input, action)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(isUUID(result.TransactionID), true, t)
+		assertfatal.Equal(calls, 3, t)
+	})
+
+	t.Run("Should give up after MaxAttempts", func(t *testing.T) {
+		calls, failures = 0, 3
+		_, err := wrapper.Wrap(context.TODO(), "transfer-456", input, action)
+		assertfatal.Equal(errors.Is(err, sqlStateError("40001")), true, t)
+		assertfatal.Equal(calls, 3, t)
+	})
+
+	t.Run("Should not retry other errors", func(t *testing.T) {
+		calls, failures = 0, 0
+		errOther := errors.New("other error")
+		_, err := wrapper.Wrap(context.TODO(), "transfer-789", input,
+			func(ctx context.Context, repos repos, idempotencyKey string,
+				input transferInput,
+			) (result transferSuccess, err error) {
+				calls++
+				err = errOther
+				return
+			})
+		assertfatal.EqualError(err, errOther, t)
+		assertfatal.Equal(calls, 1, t)
+	})
+}
+
+// sqlStateError mimics errors of SQL drivers that carry SQLSTATE codes.
+type sqlStateError string
+
+func (e sqlStateError) Error() string {
+	return "sqlstate " + string(e)
+}
+
+func (e sqlStateError) SQLState() string {
+	return string(e)
+}
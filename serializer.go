@@ -7,3 +7,35 @@ type Serializer[T any] interface {
 	Marshal(v T) ([]byte, error)
 	Unmarshal(bs []byte) (T, error)
 }
+
+// VersionedSerializer is a Serializer that is aware of the schema version of
+// the data it produces.
+//
+// The StoreAdapter saves the current Version with each Record and, on replay,
+// passes the stored version to UnmarshalVersion, so outputs persisted before a
+// schema change can still be decoded.
+type VersionedSerializer[T any] interface {
+	Serializer[T]
+	// Version returns the current schema version, used by Marshal.
+	Version() int
+	// UnmarshalVersion decodes data produced with the given schema version.
+	UnmarshalVersion(bs []byte, version int) (T, error)
+}
+
+// SerializerVersion returns the current schema version of ser if it is a
+// VersionedSerializer, and 0 otherwise.
+func SerializerVersion[T any](ser Serializer[T]) int {
+	if vser, ok := ser.(VersionedSerializer[T]); ok {
+		return vser.Version()
+	}
+	return 0
+}
+
+// UnmarshalVersion decodes data produced with the given schema version. If ser
+// is not a VersionedSerializer, the version is ignored.
+func UnmarshalVersion[T any](ser Serializer[T], bs []byte, version int) (T, error) {
+	if vser, ok := ser.(VersionedSerializer[T]); ok {
+		return vser.UnmarshalVersion(bs, version)
+	}
+	return ser.Unmarshal(bs)
+}
@@ -0,0 +1,241 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// Algorithm identifies the compression algorithm applied to a payload. Its
+// value is written in the header of every payload produced by the Serializer,
+// right after the Magic prefix.
+type Algorithm byte
+
+const (
+	// None marks a payload that is stored uncompressed.
+	None Algorithm = iota
+	// Gzip marks a payload compressed with gzip.
+	Gzip
+	// Zstd marks a payload compressed with zstd.
+	Zstd
+	// Snappy marks a payload compressed with snappy (block format).
+	Snappy
+)
+
+// DefaultThreshold is the payload size, in bytes, from which the Serializer
+// starts compressing when no threshold is specified.
+const DefaultThreshold = 1024
+
+// DefaultMaxSize is the maximum size, in bytes, of a decompressed payload
+// when no maximum is specified.
+const DefaultMaxSize = 16 << 20
+
+// Magic prefixes the header of every payload produced by the Serializer. It
+// starts with 0xFF, which never occurs in UTF-8 text, so it can't be confused
+// with the payloads written before compression was enabled.
+const Magic = "\xffIDC"
+
+// ErrUnknownAlgorithm is returned by NewSerializer when the requested
+// compression algorithm is not supported.
+var ErrUnknownAlgorithm = errors.New(idempo.ErrorPrefix + "unknown compression algorithm")
+
+// ErrPayloadTooLarge is returned by Unmarshal when the decompressed payload
+// exceeds the maximum size.
+var ErrPayloadTooLarge = errors.New(idempo.ErrorPrefix +
+	"decompressed payload too large")
+
+var (
+	zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) {
+		return zstd.NewWriter(nil)
+	})
+	// zstdDecoders holds streaming decoders, which can't be used concurrently.
+	zstdDecoders = sync.Pool{}
+)
+
+// NewSerializer creates a new Serializer that compresses the output of ser
+// with the given algorithm once it reaches threshold bytes. A threshold <= 0
+// means DefaultThreshold. Decompressed payloads are limited to
+// DefaultMaxSize, see Serializer.WithMaxSize.
+func NewSerializer[T any](ser idempo.Serializer[T], alg Algorithm,
+	threshold int,
+) (s Serializer[T], err error) {
+	if alg > Snappy {
+		err = ErrUnknownAlgorithm
+		return
+	}
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+	s = Serializer[T]{
+		ser:       ser,
+		alg:       alg,
+		threshold: threshold,
+		maxSize:   DefaultMaxSize,
+	}
+	return
+}
+
+// Serializer is an idempo.Serializer decorator that transparently compresses
+// payloads of the wrapped Serializer.
+//
+// Every payload it produces starts with a header, the Magic prefix followed by
+// the Algorithm byte, so data compressed with different algorithms, or not
+// compressed at all, can be read back regardless of the current settings.
+// Payloads without the header are treated as written before compression was
+// enabled and are passed to the wrapped Serializer as is.
+//
+// Decompression stops once the payload exceeds the maximum size, so a small
+// corrupted or forged payload can't exhaust memory.
+type Serializer[T any] struct {
+	ser       idempo.Serializer[T]
+	alg       Algorithm
+	threshold int
+	maxSize   int
+}
+
+// WithMaxSize returns a copy of the Serializer that fails with
+// ErrPayloadTooLarge when a decompressed payload exceeds maxSize bytes. A
+// maxSize <= 0 means DefaultMaxSize.
+func (s Serializer[T]) WithMaxSize(maxSize int) Serializer[T] {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	s.maxSize = maxSize
+	return s
+}
+
+func (s Serializer[T]) Marshal(v T) (bs []byte, err error) {
+	raw, err := s.ser.Marshal(v)
+	if err != nil {
+		return
+	}
+	alg := s.alg
+	if len(raw) < s.threshold {
+		alg = None
+	}
+	return encode(alg, raw)
+}
+
+func (s Serializer[T]) Unmarshal(bs []byte) (v T, err error) {
+	raw, err := decode(bs, s.maxSize)
+	if err != nil {
+		return
+	}
+	return s.ser.Unmarshal(raw)
+}
+
+// Version returns the schema version of the wrapped Serializer, so the
+// decorator remains transparent to the idempo.VersionedSerializer.
+func (s Serializer[T]) Version() int {
+	return idempo.SerializerVersion(s.ser)
+}
+
+// UnmarshalVersion decompresses bs and passes it, along with the version, to
+// the wrapped Serializer.
+func (s Serializer[T]) UnmarshalVersion(bs []byte, version int) (v T, err error) {
+	raw, err := decode(bs, s.maxSize)
+	if err != nil {
+		return
+	}
+	return idempo.UnmarshalVersion(s.ser, raw, version)
+}
+
+func encode(alg Algorithm, raw []byte) (bs []byte, err error) {
+	header := append([]byte(Magic), byte(alg))
+	switch alg {
+	case None:
+		bs = append(header, raw...)
+	case Gzip:
+		buf := bytes.NewBuffer(header)
+		w := gzip.NewWriter(buf)
+		if _, err = w.Write(raw); err != nil {
+			return
+		}
+		if err = w.Close(); err != nil {
+			return
+		}
+		bs = buf.Bytes()
+	case Zstd:
+		var enc *zstd.Encoder
+		if enc, err = zstdEncoder(); err != nil {
+			return
+		}
+		bs = enc.EncodeAll(raw, header)
+	case Snappy:
+		bs = append(header, snappy.Encode(nil, raw)...)
+	default:
+		err = ErrUnknownAlgorithm
+	}
+	return
+}
+
+func decode(bs []byte, maxSize int) (raw []byte, err error) {
+	headerLen := len(Magic) + 1
+	if len(bs) < headerLen || string(bs[:len(Magic)]) != Magic {
+		return bs, nil
+	}
+	payload := bs[headerLen:]
+	switch Algorithm(bs[len(Magic)]) {
+	case None:
+		// Uncompressed payloads are already in memory, so they are not limited.
+		raw = payload
+	case Gzip:
+		var r *gzip.Reader
+		if r, err = gzip.NewReader(bytes.NewReader(payload)); err != nil {
+			break
+		}
+		raw, err = readAll(r, maxSize)
+	case Zstd:
+		raw, err = decodeZstd(payload, maxSize)
+	case Snappy:
+		var n int
+		if n, err = snappy.DecodedLen(payload); err != nil {
+			break
+		}
+		if n > maxSize {
+			return nil, ErrPayloadTooLarge
+		}
+		raw, err = snappy.Decode(nil, payload)
+	default:
+		return nil, ErrUnknownAlgorithm
+	}
+	if err != nil && !errors.Is(err, ErrPayloadTooLarge) {
+		err = fmt.Errorf(idempo.ErrorPrefix+"decompression error: %w", err)
+	}
+	return
+}
+
+func decodeZstd(payload []byte, maxSize int) (raw []byte, err error) {
+	dec, ok := zstdDecoders.Get().(*zstd.Decoder)
+	if ok {
+		err = dec.Reset(bytes.NewReader(payload))
+	} else {
+		dec, err = zstd.NewReader(bytes.NewReader(payload),
+			zstd.WithDecoderConcurrency(1))
+	}
+	if err != nil {
+		return
+	}
+	defer func() {
+		dec.Reset(nil)
+		zstdDecoders.Put(dec)
+	}()
+	return readAll(dec, maxSize)
+}
+
+// readAll reads r until EOF, failing with ErrPayloadTooLarge once more than
+// maxSize bytes are read.
+func readAll(r io.Reader, maxSize int) (raw []byte, err error) {
+	raw, err = io.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+	if err == nil && len(raw) > maxSize {
+		return nil, ErrPayloadTooLarge
+	}
+	return
+}
@@ -0,0 +1,106 @@
+package compress
+
+import (
+	"strings"
+	"testing"
+
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	serializer "github.com/ymz-ncnk/idempo-go/serializer/json"
+)
+
+type output struct {
+	Value string
+}
+
+func TestSerializer(t *testing.T) {
+	var (
+		jsonSer = serializer.JSONSerializer[output]{}
+		small   = output{Value: "small"}
+		large   = output{Value: strings.Repeat("large", 1000)}
+	)
+	for _, alg := range []Algorithm{None, Gzip, Zstd, Snappy} {
+		ser, err := NewSerializer(jsonSer, alg, 0)
+		assertfatal.EqualError(err, nil, t)
+
+		for _, v := range []output{small, large} {
+			bs, err := ser.Marshal(v)
+			assertfatal.EqualError(err, nil, t)
+			if len(v.Value) < DefaultThreshold {
+				assertfatal.Equal(Algorithm(bs[len(Magic)]), None, t)
+			} else {
+				assertfatal.Equal(Algorithm(bs[len(Magic)]), alg, t)
+			}
+			actual, err := ser.Unmarshal(bs)
+			assertfatal.EqualError(err, nil, t)
+			assertfatal.Equal(actual, v, t)
+		}
+	}
+
+	t.Run("Should read payloads written without compression", func(t *testing.T) {
+		ser, err := NewSerializer(jsonSer, Zstd, 0)
+		assertfatal.EqualError(err, nil, t)
+		bs, err := jsonSer.Marshal(large)
+		assertfatal.EqualError(err, nil, t)
+		actual, err := ser.Unmarshal(bs)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(actual, large, t)
+	})
+
+	t.Run("Should read legacy payloads starting with algorithm bytes",
+		func(t *testing.T) {
+			ser, err := NewSerializer[[]byte](bytesSerializer{}, Zstd, 0)
+			assertfatal.EqualError(err, nil, t)
+			for _, bs := range [][]byte{
+				{byte(None), 'a'},
+				{byte(Gzip), 0x1f, 0x8b},
+				{byte(Zstd)},
+				{byte(Snappy), 0x05, 'h', 'e', 'l', 'l', 'o'},
+				{0xff, 'I', 'D'},
+			} {
+				actual, err := ser.Unmarshal(bs)
+				assertfatal.EqualError(err, nil, t)
+				assertfatal.Equal(string(actual), string(bs), t)
+			}
+		})
+
+	t.Run("Should limit the decompressed size", func(t *testing.T) {
+		for _, alg := range []Algorithm{Gzip, Zstd, Snappy} {
+			ser, err := NewSerializer(jsonSer, alg, 0)
+			assertfatal.EqualError(err, nil, t)
+			bs, err := ser.Marshal(large)
+			assertfatal.EqualError(err, nil, t)
+			raw, err := jsonSer.Marshal(large)
+			assertfatal.EqualError(err, nil, t)
+
+			_, err = ser.WithMaxSize(len(raw) - 1).Unmarshal(bs)
+			assertfatal.EqualError(err, ErrPayloadTooLarge, t)
+
+			actual, err := ser.WithMaxSize(len(raw)).Unmarshal(bs)
+			assertfatal.EqualError(err, nil, t)
+			assertfatal.Equal(actual, large, t)
+		}
+	})
+
+	t.Run("Should fail on unknown algorithm", func(t *testing.T) {
+		_, err := NewSerializer(jsonSer, Snappy+1, 0)
+		assertfatal.EqualError(err, ErrUnknownAlgorithm, t)
+	})
+
+	t.Run("Should fail on unknown algorithm in header", func(t *testing.T) {
+		ser, err := NewSerializer(jsonSer, Zstd, 0)
+		assertfatal.EqualError(err, nil, t)
+		_, err = ser.Unmarshal(append([]byte(Magic), byte(Snappy+1)))
+		assertfatal.EqualError(err, ErrUnknownAlgorithm, t)
+	})
+}
+
+// bytesSerializer passes payloads as is.
+type bytesSerializer struct{}
+
+func (bytesSerializer) Marshal(v []byte) ([]byte, error) {
+	return v, nil
+}
+
+func (bytesSerializer) Unmarshal(bs []byte) ([]byte, error) {
+	return bs, nil
+}
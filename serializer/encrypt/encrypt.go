@@ -0,0 +1,125 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// ErrMalformedPayload is returned by the Serializer when a payload is too short
+// or its header is corrupted.
+var ErrMalformedPayload = errors.New(idempo.ErrorPrefix + "malformed encrypted payload")
+
+// NewSerializer creates a new Serializer that seals the output of ser with
+// keys supplied by keys.
+func NewSerializer[T any](ser idempo.Serializer[T], keys KeyProvider) Serializer[T] {
+	return Serializer[T]{ser: ser, keys: keys}
+}
+
+// Serializer is an idempo.Serializer decorator that encrypts payloads of the
+// wrapped Serializer with AES-GCM.
+//
+// A sealed payload has the following layout:
+//
+//	[key ID length: 1 byte][key ID][nonce][ciphertext + tag]
+//
+// The key ID is also used as additional authenticated data, so it can't be
+// changed without failing decryption.
+//
+// When combined with the compress.Serializer, compression should be applied
+// first (i.e. wrapped by this Serializer), since ciphertext doesn't compress.
+type Serializer[T any] struct {
+	ser  idempo.Serializer[T]
+	keys KeyProvider
+}
+
+func (s Serializer[T]) Marshal(v T) (bs []byte, err error) {
+	plaintext, err := s.ser.Marshal(v)
+	if err != nil {
+		return
+	}
+	id, key, err := s.keys.CurrentKey()
+	if err != nil {
+		return
+	}
+	if len(id) > 255 {
+		err = fmt.Errorf(idempo.ErrorPrefix+"key ID %q is too long", id)
+		return
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return
+	}
+	header := make([]byte, 1+len(id)+aead.NonceSize())
+	header[0] = byte(len(id))
+	copy(header[1:], id)
+	nonce := header[1+len(id):]
+	if _, err = rand.Read(nonce); err != nil {
+		return
+	}
+	bs = aead.Seal(header, nonce, plaintext, []byte(id))
+	return
+}
+
+func (s Serializer[T]) Unmarshal(bs []byte) (v T, err error) {
+	plaintext, err := s.open(bs)
+	if err != nil {
+		return
+	}
+	return s.ser.Unmarshal(plaintext)
+}
+
+// Version returns the schema version of the wrapped Serializer, so the
+// decorator remains transparent to the idempo.VersionedSerializer.
+func (s Serializer[T]) Version() int {
+	return idempo.SerializerVersion(s.ser)
+}
+
+// UnmarshalVersion decrypts bs and passes it, along with the version, to the
+// wrapped Serializer.
+func (s Serializer[T]) UnmarshalVersion(bs []byte, version int) (v T, err error) {
+	plaintext, err := s.open(bs)
+	if err != nil {
+		return
+	}
+	return idempo.UnmarshalVersion(s.ser, plaintext, version)
+}
+
+func (s Serializer[T]) open(bs []byte) (plaintext []byte, err error) {
+	if len(bs) == 0 || len(bs) < 1+int(bs[0]) {
+		err = ErrMalformedPayload
+		return
+	}
+	id := string(bs[1 : 1+bs[0]])
+	key, err := s.keys.Key(id)
+	if err != nil {
+		return
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return
+	}
+	rest := bs[1+len(id):]
+	if len(rest) < aead.NonceSize() {
+		err = ErrMalformedPayload
+		return
+	}
+	nonce, ciphertext := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	plaintext, err = aead.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"decryption error: %w", err)
+	}
+	return
+}
+
+func newAEAD(key []byte) (aead cipher.AEAD, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,55 @@
+package encrypt
+
+import (
+	"bytes"
+	"testing"
+
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	serializer "github.com/ymz-ncnk/idempo-go/serializer/json"
+)
+
+type output struct {
+	AccountNumber string
+}
+
+func TestSerializer(t *testing.T) {
+	var (
+		jsonSer = serializer.JSONSerializer[output]{}
+		key1    = bytes.Repeat([]byte{1}, 32)
+		key2    = bytes.Repeat([]byte{2}, 32)
+		v       = output{AccountNumber: "DE89370400440532013000"}
+	)
+	keys, err := NewStaticKeyProvider("key-1", map[string][]byte{"key-1": key1})
+	assertfatal.EqualError(err, nil, t)
+	ser := NewSerializer(jsonSer, keys)
+
+	bs, err := ser.Marshal(v)
+	assertfatal.EqualError(err, nil, t)
+	assertfatal.Equal(bytes.Contains(bs, []byte(v.AccountNumber)), false, t)
+
+	t.Run("Should decrypt payload", func(t *testing.T) {
+		actual, err := ser.Unmarshal(bs)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(actual, v, t)
+	})
+
+	t.Run("Should decrypt payload sealed with a previous key after rotation",
+		func(t *testing.T) {
+			keys, err := NewStaticKeyProvider("key-2", map[string][]byte{
+				"key-1": key1,
+				"key-2": key2,
+			})
+			assertfatal.EqualError(err, nil, t)
+			ser := NewSerializer(jsonSer, keys)
+			actual, err := ser.Unmarshal(bs)
+			assertfatal.EqualError(err, nil, t)
+			assertfatal.Equal(actual, v, t)
+		})
+
+	t.Run("Should fail if key is unknown", func(t *testing.T) {
+		keys, err := NewStaticKeyProvider("key-2", map[string][]byte{"key-2": key2})
+		assertfatal.EqualError(err, nil, t)
+		_, err = NewSerializer(jsonSer, keys).Unmarshal(bs)
+		assertfatal.EqualError(err, ErrKeyNotFound, t)
+	})
+}
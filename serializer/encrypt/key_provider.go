@@ -0,0 +1,55 @@
+package encrypt
+
+import (
+	"errors"
+
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// ErrKeyNotFound is returned by a KeyProvider when no key is registered under
+// the requested ID.
+var ErrKeyNotFound = errors.New(idempo.ErrorPrefix + "encryption key not found")
+
+// KeyProvider supplies the AES keys used by the Serializer.
+//
+// Keys are identified by IDs, which are embedded into every sealed payload.
+// This allows keys to be rotated: new payloads are sealed with the current
+// key, while payloads sealed earlier are opened with the key they refer to.
+type KeyProvider interface {
+	// CurrentKey returns the ID and the key used to seal new payloads.
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key registered under the given ID, or ErrKeyNotFound.
+	Key(id string) (key []byte, err error)
+}
+
+// NewStaticKeyProvider creates a new StaticKeyProvider. The keys map must
+// contain currentID.
+func NewStaticKeyProvider(currentID string, keys map[string][]byte) (
+	p StaticKeyProvider, err error,
+) {
+	if _, pst := keys[currentID]; !pst {
+		err = ErrKeyNotFound
+		return
+	}
+	p = StaticKeyProvider{currentID: currentID, keys: keys}
+	return
+}
+
+// StaticKeyProvider is an in-memory KeyProvider with a fixed set of keys,
+// intended mostly for tests.
+type StaticKeyProvider struct {
+	currentID string
+	keys      map[string][]byte
+}
+
+func (p StaticKeyProvider) CurrentKey() (id string, key []byte, err error) {
+	return p.currentID, p.keys[p.currentID], nil
+}
+
+func (p StaticKeyProvider) Key(id string) (key []byte, err error) {
+	key, pst := p.keys[id]
+	if !pst {
+		err = ErrKeyNotFound
+	}
+	return
+}
@@ -0,0 +1,65 @@
+package versioned
+
+import (
+	"fmt"
+
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// Upcaster converts data of one schema version into the data of the next
+// version, e.g. by adding a field with a default value to a JSON document.
+type Upcaster func(bs []byte) ([]byte, error)
+
+// NewSerializer creates a new Serializer on top of ser, which must be able to
+// decode the latest schema version.
+//
+// upcasters[i] converts data of version i+1 into version i+2, so the current
+// version is len(upcasters)+1. Upcasters are only ever appended, one per
+// schema change.
+func NewSerializer[T any](ser idempo.Serializer[T],
+	upcasters ...Upcaster,
+) Serializer[T] {
+	return Serializer[T]{ser: ser, upcasters: upcasters}
+}
+
+// Serializer is an idempo.VersionedSerializer that upgrades outdated data with
+// a chain of Upcasters before decoding it.
+//
+// Records stored before the Serializer was introduced have no schema version
+// (0) and are treated as version 1.
+type Serializer[T any] struct {
+	ser       idempo.Serializer[T]
+	upcasters []Upcaster
+}
+
+func (s Serializer[T]) Marshal(v T) ([]byte, error) {
+	return s.ser.Marshal(v)
+}
+
+func (s Serializer[T]) Unmarshal(bs []byte) (T, error) {
+	return s.ser.Unmarshal(bs)
+}
+
+// Version returns the current schema version.
+func (s Serializer[T]) Version() int {
+	return len(s.upcasters) + 1
+}
+
+// UnmarshalVersion applies the Upcasters required to bring bs from the given
+// version to the current one, and decodes the result.
+func (s Serializer[T]) UnmarshalVersion(bs []byte, version int) (v T, err error) {
+	if version == 0 {
+		version = 1
+	}
+	if version < 0 || version > s.Version() {
+		err = fmt.Errorf(idempo.ErrorPrefix+"unsupported schema version %d", version)
+		return
+	}
+	for i := version - 1; i < len(s.upcasters); i++ {
+		if bs, err = s.upcasters[i](bs); err != nil {
+			err = fmt.Errorf(idempo.ErrorPrefix+"upcast from version %d: %w", i+1, err)
+			return
+		}
+	}
+	return s.ser.Unmarshal(bs)
+}
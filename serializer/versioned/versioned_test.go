@@ -0,0 +1,63 @@
+package versioned
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+	serializer "github.com/ymz-ncnk/idempo-go/serializer/json"
+)
+
+// outputV2 is the second version of the output, where Name was renamed to
+// Holder and Currency was added.
+type outputV2 struct {
+	Holder   string
+	Currency string
+}
+
+func TestSerializer(t *testing.T) {
+	var (
+		v1ToV2 = func(bs []byte) ([]byte, error) {
+			bs = bytes.Replace(bs, []byte(`"Name"`), []byte(`"Holder"`), 1)
+			return bytes.Replace(bs, []byte(`}`), []byte(`,"Currency":"EUR"}`), 1), nil
+		}
+		ser   = NewSerializer(serializer.JSONSerializer[outputV2]{}, v1ToV2)
+		store = &store{}
+		key   = idempo.Key{IdempotencyKey: "key"}
+	)
+	assertfatal.Equal(ser.Version(), 2, t)
+	// Record saved before the Serializer was introduced.
+	store.record = idempo.Record{
+		ID:            "key",
+		InputHash:     "hash",
+		SuccessOutput: true,
+		Output:        []byte(`{"Name":"John"}`),
+	}
+
+	adapter := idempo.NewStoreAdapter[outputV2, outputV2](ser, ser, nil)
+	ok, output, err := adapter.AlreadyProcessed(context.Background(), key,
+		idempo.InputHash{Value: "hash"}, store)
+	assertfatal.EqualError(err, nil, t)
+	assertfatal.Equal(ok, true, t)
+	assertfatal.Equal(output, outputV2{Holder: "John", Currency: "EUR"}, t)
+
+	err = adapter.SaveSuccessOutput(context.Background(), key, "hash",
+		output, store)
+	assertfatal.EqualError(err, nil, t)
+	assertfatal.Equal(store.record.SchemaVersion, 2, t)
+}
+
+type store struct {
+	record idempo.Record
+}
+
+func (s *store) Get(ctx context.Context, id string) (idempo.Record, error) {
+	return s.record, nil
+}
+
+func (s *store) Save(ctx context.Context, record idempo.Record) error {
+	s.record = record
+	return nil
+}
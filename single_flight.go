@@ -0,0 +1,89 @@
+package idempo
+
+import (
+	"context"
+	"sync"
+)
+
+// newSingleFlight creates a new singleFlight.
+func newSingleFlight[S any]() *singleFlight[S] {
+	return &singleFlight[S]{flights: make(map[string]*flight[S])}
+}
+
+// singleFlight deduplicates concurrent executions with the same Record ID
+// within the process.
+type singleFlight[S any] struct {
+	mu      sync.Mutex
+	flights map[string]*flight[S]
+}
+
+// flight is an execution in progress, whose outcome is shared with the
+// followers once the leader is done.
+type flight[S any] struct {
+	done          chan struct{}
+	inputHash     string
+	successOutput S
+	err           error
+	// committed is true if the outcome was committed, e.g. the success output
+	// was saved.
+	committed bool
+}
+
+// join returns the flight for the given id, which the caller leads if leader
+// is true.
+func (g *singleFlight[S]) join(id string) (f *flight[S], leader bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if f, ok := g.flights[id]; ok {
+		return f, false
+	}
+	f = &flight[S]{done: make(chan struct{})}
+	g.flights[id] = f
+	return f, true
+}
+
+// land removes the flight and releases its followers.
+func (g *singleFlight[S]) land(id string, f *flight[S]) {
+	g.mu.Lock()
+	delete(g.flights, id)
+	g.mu.Unlock()
+	close(f.done)
+}
+
+// wrapSingleFlight executes the Action like wrap, but lets only one of the
+// concurrent calls with the same key (the leader) open a UnitOfWork.
+//
+// Followers wait for the leader and receive its committed outcome as a
+// replay, if their input hash is the same. Otherwise they are checked against
+// the Store as usual. If the leader's outcome was rolled back, followers
+// elect a new leader.
+func (w Wrapper[T, I, S, F]) wrapSingleFlight(ctx context.Context, key Key,
+	inputHash InputHash,
+	input I,
+	action Action[T, I, S],
+) (successOutput S, err error) {
+	for {
+		f, leader := w.singleFlight.join(key.ID())
+		if leader {
+			defer w.singleFlight.land(key.ID(), f)
+			successOutput, f.committed, err = w.wrap(ctx, key, inputHash, input,
+				action)
+			f.inputHash, f.successOutput, f.err = inputHash.Value, successOutput, err
+			return
+		}
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case <-f.done:
+		}
+		if !f.committed {
+			continue
+		}
+		if f.inputHash != inputHash.Value {
+			successOutput, _, err = w.wrap(ctx, key, inputHash, input, action)
+			return
+		}
+		return f.successOutput, f.err
+	}
+}
@@ -0,0 +1,92 @@
+package idempo_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+func TestSingleFlight(t *testing.T) {
+	conf := newConf(newUnitOfWork(newDB()))
+	conf.SingleFlight = true
+	var (
+		wrapper = idempo.NewWrapper[repos, transferInput](conf)
+		started = make(chan struct{})
+		release = make(chan struct{})
+		calls   atomic.Int32
+		action  = func(ctx context.Context, repos repos, idempotencyKey string,
+			input transferInput,
+		) (result transferSuccess, err error) {
+			if calls.Add(1) == 1 {
+				close(started)
+				<-release
+			}
+			result.TransactionID = uuid.NewString()
+			return
+		}
+		idempotencyKey = "transfer-123"
+		input          = transferInput{FromAccount: "A", ToAccount: "B", Amount: 1}
+		leaderResult   transferSuccess
+		leaderErr      error
+		leaderDone     = make(chan struct{})
+	)
+	go func() {
+		defer close(leaderDone)
+		leaderResult, leaderErr = wrapper.Wrap(context.TODO(), idempotencyKey,
+			input, action)
+	}()
+	<-started
+
+	t.Run("Follower should respect its context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := wrapper.Wrap(ctx, idempotencyKey, input, action)
+		assertfatal.EqualError(err, context.Canceled, t)
+	})
+
+	var (
+		wg              sync.WaitGroup
+		followerResults = make([]transferSuccess, 5)
+		followerErrs    = make([]error, 5)
+		mismatchErr     error
+	)
+	for i := range followerResults {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			followerResults[i], followerErrs[i] = wrapper.Wrap(context.TODO(),
+				idempotencyKey, input, action)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		input := input
+		input.Amount = 2
+		_, mismatchErr = wrapper.Wrap(context.TODO(), idempotencyKey, input, action)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	<-leaderDone
+	wg.Wait()
+	assertfatal.EqualError(leaderErr, nil, t)
+
+	t.Run("Followers should receive the leader's outcome", func(t *testing.T) {
+		for i := range followerResults {
+			assertfatal.EqualError(followerErrs[i], nil, t)
+			assertfatal.Equal(followerResults[i], leaderResult, t)
+		}
+		assertfatal.Equal(calls.Load(), int32(1), t)
+	})
+
+	t.Run("Follower with another input should fail with ErrHashMismatch",
+		func(t *testing.T) {
+			assertfatal.EqualError(mismatchErr, idempo.ErrHashMismatch, t)
+		})
+}
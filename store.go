@@ -9,5 +9,61 @@ type Store interface {
 	// Get retrieves an idempotency Record by its unique ID (idempotencyKey).
 	Get(ctx context.Context, id string) (Record, error)
 	// Save attempts to persist a new Record.
+	//
+	// If the Store doesn't implement the Deleter interface, Save must replace
+	// an expired Record with the same ID.
 	Save(ctx context.Context, record Record) error
 }
+
+// Deleter is an optional interface a Store may implement to support deleting
+// Records. The StoreAdapter uses it to remove expired Records.
+type Deleter interface {
+	// Delete removes the Record with the given ID. Deleting a non-existent
+	// Record is not an error.
+	Delete(ctx context.Context, id string) error
+}
+
+// Updater is an optional interface a Store may implement to support
+// replacing an existing Record.
+type Updater interface {
+	// Update replaces the Record with the same ID. Returns
+	// ErrIdempotencyRecordNotFound if there is no such Record.
+	Update(ctx context.Context, record Record) error
+}
+
+// FencedStore is an optional interface a Store may implement to write
+// in-progress Records conditionally on their lease (see Lease).
+//
+// Each method must be a single compare-and-swap on the LeaseOwner and
+// FencingToken fields, e.g. UPDATE ... WHERE fencing_token = ? or a
+// conditional put, rather than a read followed by a write. Otherwise, under
+// snapshot isolation or without transactional reads, a stale owner could
+// overwrite the Record of the owner that took it over.
+type FencedStore interface {
+	// UpdateFenced replaces the Record with the same ID if it is in progress
+	// and held under the claim. Returns ErrLeaseLost otherwise.
+	UpdateFenced(ctx context.Context, claim Claim, record Record) error
+	// DeleteFenced deletes the Record with the given ID if it is in progress
+	// and held under the claim. Returns ErrLeaseLost otherwise.
+	DeleteFenced(ctx context.Context, claim Claim, id string) error
+}
+
+// ScopedStore is an optional interface a Store may implement to support
+// listing and purging Records by scope (see KeyScope).
+type ScopedStore interface {
+	// List returns all Records of the given scope.
+	List(ctx context.Context, scope string) ([]Record, error)
+	// Purge deletes all Records of the given scope.
+	Purge(ctx context.Context, scope string) error
+}
+
+// BatchStore is an optional interface a Store may implement to support
+// retrieving and persisting Records in batches. Wrapper.WrapBatch falls back
+// to Get and Save calls if the Store doesn't implement it.
+type BatchStore interface {
+	// GetMany retrieves the Records with the given IDs. Missing Records are
+	// omitted from the result.
+	GetMany(ctx context.Context, ids []string) (map[string]Record, error)
+	// SaveMany attempts to persist new Records.
+	SaveMany(ctx context.Context, records []Record) error
+}
@@ -2,6 +2,8 @@ package idempo
 
 import (
 	"context"
+	"fmt"
+	"time"
 )
 
 // FailToError defines the function that converts a stored failure output ('F')
@@ -29,7 +31,7 @@ func NewStoreAdapter[S, F any](successSer Serializer[S], failureSer Serializer[F
 // failure data back into an application error.
 type StoreAdapter[S, F any] interface {
 	// AlreadyProcessed checks the Store for a record associated with the given
-	// idempotency key.
+	// key.
 	//
 	// If a record is found (ok=true):
 	//  1. It reconstructs the original result (either successOutput or an error).
@@ -37,17 +39,33 @@ type StoreAdapter[S, F any] interface {
 	//  3. If the record is a failure, it deserializes the failure output (F) and
 	//     uses the internal failureToError function to return the original error.
 	//
-	// Returns (false, nil, nil) if no record is found.
-	AlreadyProcessed(ctx context.Context, idempotencyKey string, inputHash string,
+	// Expired records are treated as not found and are deleted if the Store
+	// implements the Deleter interface.
+	//
+	// The stored hash is compared with inputHash using InputHash.Match, so
+	// Records saved with a previous hash remain valid. If inputHash.Rewrite is
+	// set, such Records are updated to the current hash.
+	//
+	// Returns ErrInProgress if the record is in progress (see Wrapper.Submit),
+	// and (false, nil, nil) if no record is found.
+	AlreadyProcessed(ctx context.Context, key Key, inputHash InputHash,
 		store Store) (ok bool, successOutput S, err error)
+	// Replay reconstructs the result stored in the completed record: either
+	// the successOutput or the error converted from the failure output.
+	Replay(record Record) (successOutput S, err error)
+	// SaveInProgress persists a record marking the execution associated with
+	// the key as in progress, under the given lease.
+	SaveInProgress(ctx context.Context, key Key, inputHash string, claim Claim,
+		store Store) (err error)
 	// SaveSuccessOutput serializes the successful output (S) and persists it
 	// to the Store. The inputHash is included to detect non-idempotent re-attempts.
-	SaveSuccessOutput(ctx context.Context, idempotencyKey, inputHash string,
+	SaveSuccessOutput(ctx context.Context, key Key, inputHash string,
 		successOutput S, store Store) (err error)
 	// SaveFailOutput serializes the failure output (F) and persists it to the
 	// Store. This allows the client to receive the same failure error upon retry.
-	SaveFailOutput(ctx context.Context, idempotencyKey, inputHash string,
-		failureOutput F, store Store) (err error)
+	// If ttl > 0, the Record expires after it.
+	SaveFailOutput(ctx context.Context, key Key, inputHash string,
+		failureOutput F, ttl time.Duration, store Store) (err error)
 }
 
 type storeAdapter[S, F any] struct {
@@ -57,30 +75,64 @@ type storeAdapter[S, F any] struct {
 }
 
 func (a storeAdapter[S, F]) AlreadyProcessed(ctx context.Context,
-	idempotencyKey string,
-	inputHash string,
+	key Key,
+	inputHash InputHash,
 	store Store,
 ) (ok bool, successOutput S, err error) {
-	record, err := store.Get(ctx, idempotencyKey)
+	record, err := store.Get(ctx, key.ID())
 	if err != nil {
 		if err == ErrIdempotencyRecordNotFound {
 			err = nil
 		}
 		return
 	}
-	if record.InputHash != inputHash {
+	if record.Expired(time.Now()) {
+		if deleter, isDeleter := store.(Deleter); isDeleter {
+			if err = deleter.Delete(ctx, record.ID); err != nil {
+				err = fmt.Errorf(ErrorPrefix+"failed to delete expired record: %w", err)
+			}
+		}
+		return
+	}
+	if inputHash, err = inputHash.resolveFor(record.InputHash); err != nil {
+		err = fmt.Errorf(ErrorPrefix+"failed to calculate input hash: %w", err)
+		return
+	}
+	if !inputHash.Match(record.InputHash) {
 		err = ErrHashMismatch
 		return
 	}
+	// In-progress Records are written only under their lease (see
+	// FencedStore), so only completed ones are rewritten.
+	if record.InProgress {
+		err = ErrInProgress
+		return
+	}
+	if inputHash.Rewrite && record.InputHash != inputHash.Value {
+		if updater, isUpdater := store.(Updater); isUpdater {
+			record.InputHash = inputHash.Value
+			if err = updater.Update(ctx, record); err != nil {
+				err = fmt.Errorf(ErrorPrefix+"failed to rewrite input hash: %w", err)
+				return
+			}
+		}
+	}
 	ok = true
+	successOutput, err = a.Replay(record)
+	return
+}
+
+func (a storeAdapter[S, F]) Replay(record Record) (successOutput S, err error) {
 	if record.SuccessOutput {
-		successOutput, err = a.successSer.Unmarshal(record.Output)
+		successOutput, err = UnmarshalVersion(a.successSer, record.Output,
+			record.SchemaVersion)
 		if err != nil {
 			err = NewSuccessOutputUnmarshalError(err)
 		}
 		return
 	}
-	failOutput, err := a.failureSer.Unmarshal(record.Output)
+	failOutput, err := UnmarshalVersion(a.failureSer, record.Output,
+		record.SchemaVersion)
 	if err != nil {
 		err = NewFailureOutputUnmarshalError(err)
 		return
@@ -90,7 +142,8 @@ func (a storeAdapter[S, F]) AlreadyProcessed(ctx context.Context,
 }
 
 func (a storeAdapter[S, F]) SaveSuccessOutput(ctx context.Context,
-	idempotencyKey, inputHash string,
+	key Key,
+	inputHash string,
 	successOutput S,
 	store Store,
 ) (err error) {
@@ -100,17 +153,21 @@ func (a storeAdapter[S, F]) SaveSuccessOutput(ctx context.Context,
 		return
 	}
 	record := Record{
-		ID:            idempotencyKey,
+		ID:            key.ID(),
 		InputHash:     inputHash,
 		SuccessOutput: true,
 		Output:        output,
+		SchemaVersion: SerializerVersion(a.successSer),
+		Scope:         key.Scope,
 	}
 	return store.Save(ctx, record)
 }
 
 func (a storeAdapter[S, F]) SaveFailOutput(ctx context.Context,
-	idempotencyKey, inputHash string,
+	key Key,
+	inputHash string,
 	failOutput F,
+	ttl time.Duration,
 	store Store,
 ) (err error) {
 	output, err := a.failureSer.Marshal(failOutput)
@@ -120,10 +177,33 @@ func (a storeAdapter[S, F]) SaveFailOutput(ctx context.Context,
 		return
 	}
 	record := Record{
-		ID:            idempotencyKey,
+		ID:            key.ID(),
 		InputHash:     inputHash,
 		SuccessOutput: false,
 		Output:        output,
+		SchemaVersion: SerializerVersion(a.failureSer),
+		Scope:         key.Scope,
+	}
+	if ttl > 0 {
+		record.ExpiresAt = time.Now().Add(ttl)
+	}
+	return store.Save(ctx, record)
+}
+
+func (a storeAdapter[S, F]) SaveInProgress(ctx context.Context,
+	key Key,
+	inputHash string,
+	claim Claim,
+	store Store,
+) (err error) {
+	record := Record{
+		ID:             key.ID(),
+		InputHash:      inputHash,
+		Scope:          key.Scope,
+		InProgress:     true,
+		LeaseOwner:     claim.Owner,
+		LeaseExpiresAt: claim.ExpiresAt,
+		FencingToken:   claim.FencingToken,
 	}
 	return store.Save(ctx, record)
 }
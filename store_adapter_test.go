@@ -0,0 +1,82 @@
+package idempo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	serializer "github.com/ymz-ncnk/idempo-go/serializer/json"
+)
+
+func TestStoreAdapter(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		key     = Key{IdempotencyKey: "order-1"}
+		adapter = NewStoreAdapter(serializer.JSONSerializer[string]{},
+			serializer.JSONSerializer[string]{}, nil)
+		inputHash = InputHash{Value: "new", Previous: []string{"old"},
+			Rewrite: true}
+	)
+
+	t.Run("Should not rewrite the input hash of an in-progress record",
+		func(t *testing.T) {
+			store := &updateCountingStore{record: Record{
+				ID:             key.ID(),
+				InputHash:      "old",
+				InProgress:     true,
+				LeaseExpiresAt: time.Now().Add(time.Minute),
+				FencingToken:   1,
+			}}
+			_, _, err := adapter.AlreadyProcessed(ctx, key, inputHash, store)
+			assertfatal.EqualError(err, ErrInProgress, t)
+			assertfatal.Equal(store.updates, 0, t)
+			assertfatal.Equal(store.record.InputHash, "old", t)
+		})
+
+	t.Run("Should rewrite the input hash of a completed record",
+		func(t *testing.T) {
+			output, err := serializer.JSONSerializer[string]{}.Marshal("order-1")
+			assertfatal.EqualError(err, nil, t)
+			store := &updateCountingStore{record: Record{
+				ID:            key.ID(),
+				InputHash:     "old",
+				SuccessOutput: true,
+				Output:        output,
+			}}
+			ok, successOutput, err := adapter.AlreadyProcessed(ctx, key, inputHash,
+				store)
+			assertfatal.EqualError(err, nil, t)
+			assertfatal.Equal(ok, true, t)
+			assertfatal.Equal(successOutput, "order-1", t)
+			assertfatal.Equal(store.updates, 1, t)
+			assertfatal.Equal(store.record.InputHash, "new", t)
+		})
+}
+
+// updateCountingStore holds a single Record and counts its updates.
+type updateCountingStore struct {
+	record  Record
+	updates int
+}
+
+func (s *updateCountingStore) Get(ctx context.Context, id string) (
+	record Record, err error,
+) {
+	if id != s.record.ID {
+		err = ErrIdempotencyRecordNotFound
+		return
+	}
+	return s.record, nil
+}
+
+func (s *updateCountingStore) Save(ctx context.Context, record Record) error {
+	s.record = record
+	return nil
+}
+
+func (s *updateCountingStore) Update(ctx context.Context, record Record) error {
+	s.updates++
+	s.record = record
+	return nil
+}
@@ -1,5 +1,7 @@
 package idempo
 
+import "context"
+
 // UOWRepos is the constraint interface required by the generic UnitOfWork.
 // Any type T passed to UnitOfWork must implement this method.
 type UOWRepos interface {
@@ -12,3 +14,29 @@ type UnitOfWork[T UOWRepos] interface {
 	// transaction. It automatically handles BEGIN, COMMIT, and ROLLBACK.
 	Execute(fn func(repos T) error) error
 }
+
+// ContextUnitOfWork is an optional interface of the UnitOfWork, whose
+// transactions depend on the context of the call, e.g. to be cancelled with
+// it. If implemented, the Wrapper uses ExecuteContext instead of Execute.
+//
+// fn receives a context of the transaction, derived from ctx, which is then
+// passed to the Store and the Action. It allows the UnitOfWork to recognize
+// nested calls made by the Action, e.g. to run them within savepoints.
+type ContextUnitOfWork[T UOWRepos] interface {
+	UnitOfWork[T]
+	ExecuteContext(ctx context.Context,
+		fn func(ctx context.Context, repos T) error) error
+}
+
+// executeContext executes fn within the unitOfWork, passing it ctx if the
+// unitOfWork implements the ContextUnitOfWork interface.
+func executeContext[T UOWRepos](ctx context.Context, unitOfWork UnitOfWork[T],
+	fn func(ctx context.Context, repos T) error,
+) error {
+	if cu, ok := unitOfWork.(ContextUnitOfWork[T]); ok {
+		return cu.ExecuteContext(ctx, fn)
+	}
+	return unitOfWork.Execute(func(repos T) error {
+		return fn(ctx, repos)
+	})
+}
@@ -0,0 +1,8 @@
+package dynamodb
+
+import "github.com/ymz-ncnk/idempo-go"
+
+// RepositoryBundleFactory is a function that accepts a transaction (Tx) and
+// constructs the full application and idempotency repository bundle (T) for
+// that specific transaction.
+type RepositoryBundleFactory[T idempo.UOWRepos] func(tx *Tx) T
@@ -0,0 +1,402 @@
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// DynamoDBIdempotencyTableName is the default table name for idempotency
+// records.
+const DynamoDBIdempotencyTableName = "idempotency_records"
+
+const (
+	// pkAttr is the partition key attribute, which holds the Record ID.
+	pkAttr = "pk"
+	// ttlAttr is the native TTL attribute, which holds the Record.ExpiresAt in
+	// epoch seconds.
+	ttlAttr = "expiresAt"
+)
+
+// CreateTable creates the table for idempotency records with on-demand
+// capacity, and enables native TTL on the expiresAt attribute.
+func CreateTable(ctx context.Context, client *dynamodb.Client,
+	table string,
+) (err error) {
+	_, err = client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String(table),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String(pkAttr), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String(pkAttr), KeyType: types.KeyTypeHash},
+		},
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		return fmt.Errorf(idempo.ErrorPrefix+"dynamodb create table error: %w", err)
+	}
+	waiter := dynamodb.NewTableExistsWaiter(client)
+	err = waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)},
+		time.Minute)
+	if err != nil {
+		return fmt.Errorf(idempo.ErrorPrefix+"dynamodb create table error: %w", err)
+	}
+	_, err = client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(table),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String(ttlAttr),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"dynamodb update ttl error: %w", err)
+	}
+	return
+}
+
+// NewIdempotencyStore returns a new DynamoDB idempotency store, which adds
+// its writes to the transaction.
+func NewIdempotencyStore(tx *Tx, table string) idempo.Store {
+	return &IdempotencyStore{
+		tx:      tx,
+		table:   table,
+		pending: make(map[string]pendingWrite),
+	}
+}
+
+// IdempotencyStore implements the app.IdempotencyStore interface.
+//
+// Save is conditioned on attribute_not_exists(pk), so if concurrent units of
+// work execute an Action with the same idempotency key, only one of them
+// commits. DynamoDB removes records with expired ExpiresAt in the background,
+// so they may still be returned for a while.
+//
+// A transaction can't contain several writes of the same item, so the writes
+// of the same record within a UnitOfWork are coalesced into one, and Get
+// returns the pending write, if any.
+type IdempotencyStore struct {
+	tx      *Tx
+	table   string
+	pending map[string]pendingWrite
+}
+
+// pendingWrite is a write of the record added to the transaction.
+type pendingWrite struct {
+	index int
+	// record is nil if the write is a delete.
+	record *idempo.Record
+	// created is true if the write creates a new record.
+	created bool
+	// cond is the condition of the write on the stored record.
+	cond condition
+}
+
+// condition is the condition of a write on the stored record.
+type condition struct {
+	expression *string
+	values     map[string]types.AttributeValue
+	// fenced is true if the write is conditioned on a lease.
+	fenced bool
+}
+
+// Get retrieves an IdempotencyRecord by key.
+func (s *IdempotencyStore) Get(ctx context.Context, id string) (
+	record idempo.Record, err error,
+) {
+	if p, ok := s.pending[id]; ok {
+		if p.record == nil {
+			err = idempo.ErrIdempotencyRecordNotFound
+			return
+		}
+		return *p.record, nil
+	}
+	output, err := s.tx.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            pk(id),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"dynamodb get error: %w", err)
+		return
+	}
+	if output.Item == nil {
+		err = idempo.ErrIdempotencyRecordNotFound
+		return
+	}
+	var it item
+	if err = attributevalue.UnmarshalMap(output.Item, &it); err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"dynamodb unmarshal error: %w", err)
+		return
+	}
+	record = it.record()
+	return
+}
+
+// Save creates a new record.
+func (s *IdempotencyStore) Save(ctx context.Context,
+	record idempo.Record,
+) (err error) {
+	p, ok := s.pending[record.ID]
+	switch {
+	case !ok:
+		return s.put(record, true, -1, notExists())
+	case p.record == nil:
+		// The record was deleted within this transaction.
+		return s.put(record, false, p.index, p.cond)
+	default:
+		return fmt.Errorf(idempo.ErrorPrefix+"dynamodb record %q already exists",
+			record.ID)
+	}
+}
+
+// Update replaces an existing record.
+func (s *IdempotencyStore) Update(ctx context.Context,
+	record idempo.Record,
+) (err error) {
+	if _, err = s.Get(ctx, record.ID); err != nil {
+		return
+	}
+	if p, ok := s.pending[record.ID]; ok {
+		return s.put(record, p.created, p.index, p.cond)
+	}
+	return s.put(record, false, -1,
+		condition{expression: aws.String("attribute_exists(" + pkAttr + ")")})
+}
+
+// Delete removes a record.
+//
+// The Delete is conditioned on the stored record, so if it is replaced before
+// the transaction commits, e.g. an expired record re-executed concurrently,
+// the transaction is canceled (see ConflictClassifier). A Save that follows
+// the Delete within the same UnitOfWork keeps its condition.
+func (s *IdempotencyStore) Delete(ctx context.Context, id string) (err error) {
+	p, ok := s.pending[id]
+	switch {
+	case !ok:
+		record, err := s.Get(ctx, id)
+		if err == idempo.ErrIdempotencyRecordNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.delete(id, -1, recordCondition(record))
+	case p.record == nil:
+	default:
+		s.delete(id, p.index, p.cond)
+	}
+	return
+}
+
+// UpdateFenced replaces the in-progress record if it is held under the claim.
+//
+// The Put is conditioned on the claim, so if the lease is taken over before
+// the transaction commits, the UnitOfWork fails with idempo.ErrLeaseLost.
+func (s *IdempotencyStore) UpdateFenced(ctx context.Context, claim idempo.Claim,
+	record idempo.Record,
+) (err error) {
+	if p, ok := s.pending[record.ID]; ok {
+		// The pending write keeps its condition on the stored record.
+		if p.record == nil || !claim.Holds(*p.record) {
+			return idempo.ErrLeaseLost
+		}
+		return s.put(record, p.created, p.index, p.cond)
+	}
+	return s.put(record, false, -1, claimCondition(claim))
+}
+
+// DeleteFenced removes the in-progress record if it is held under the claim.
+//
+// The Delete is conditioned on the claim, so if the lease is taken over before
+// the transaction commits, the UnitOfWork fails with idempo.ErrLeaseLost.
+func (s *IdempotencyStore) DeleteFenced(ctx context.Context, claim idempo.Claim,
+	id string,
+) (err error) {
+	if p, ok := s.pending[id]; ok {
+		if p.record == nil || !claim.Holds(*p.record) {
+			return idempo.ErrLeaseLost
+		}
+		s.delete(id, p.index, p.cond)
+		return
+	}
+	s.delete(id, -1, claimCondition(claim))
+	return
+}
+
+// put adds the Put of the record to the transaction, or replaces the pending
+// write at index with it, if index >= 0.
+func (s *IdempotencyStore) put(record idempo.Record, created bool, index int,
+	cond condition,
+) (err error) {
+	av, err := attributevalue.MarshalMap(newItem(record))
+	if err != nil {
+		return fmt.Errorf(idempo.ErrorPrefix+"dynamodb marshal error: %w", err)
+	}
+	txItem := types.TransactWriteItem{Put: &types.Put{
+		TableName:                 aws.String(s.table),
+		Item:                      av,
+		ConditionExpression:       cond.expression,
+		ExpressionAttributeValues: cond.values,
+	}}
+	index = s.write(index, txItem, cond)
+	s.pending[record.ID] = pendingWrite{
+		index:   index,
+		record:  &record,
+		created: created,
+		cond:    cond,
+	}
+	return
+}
+
+// delete adds the Delete of the record to the transaction, or replaces the
+// pending write at index with it, if index >= 0.
+func (s *IdempotencyStore) delete(id string, index int, cond condition) {
+	if p, ok := s.pending[id]; ok && p.created {
+		// The record was created within this transaction, so nothing has to be
+		// written.
+		s.tx.remove(p.index)
+		delete(s.pending, id)
+		return
+	}
+	index = s.write(index, types.TransactWriteItem{Delete: &types.Delete{
+		TableName:                 aws.String(s.table),
+		Key:                       pk(id),
+		ConditionExpression:       cond.expression,
+		ExpressionAttributeValues: cond.values,
+	}}, cond)
+	s.pending[id] = pendingWrite{index: index, cond: cond}
+}
+
+func (s *IdempotencyStore) write(index int, txItem types.TransactWriteItem,
+	cond condition,
+) int {
+	if index >= 0 {
+		s.tx.set(index, txItem)
+	} else {
+		index = s.tx.add(txItem)
+	}
+	s.tx.fence(index, cond.fenced)
+	return index
+}
+
+func notExists() condition {
+	return condition{
+		expression: aws.String("attribute_not_exists(" + pkAttr + ")"),
+	}
+}
+
+// recordCondition matches the stored record, which was read as the given one.
+func recordCondition(record idempo.Record) condition {
+	values := map[string]types.AttributeValue{
+		":inputHash": &types.AttributeValueMemberS{Value: record.InputHash},
+	}
+	// Records that never expire have no expiresAtNano.
+	expiresAt := "attribute_not_exists(expiresAtNano)"
+	if it := newItem(record); it.ExpiresAtNano != 0 {
+		expiresAt = "expiresAtNano = :expiresAt"
+		values[":expiresAt"] = &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(it.ExpiresAtNano, 10)}
+	}
+	return condition{
+		expression: aws.String("inputHash = :inputHash AND " + expiresAt),
+		values:     values,
+	}
+}
+
+// claimCondition matches the in-progress record held under the claim.
+func claimCondition(claim idempo.Claim) condition {
+	values := map[string]types.AttributeValue{
+		":inProgress": &types.AttributeValueMemberBOOL{Value: true},
+		":token": &types.AttributeValueMemberN{
+			Value: strconv.FormatUint(claim.FencingToken, 10)},
+	}
+	// Empty owners are omitted from items.
+	owner := "attribute_not_exists(leaseOwner)"
+	if claim.Owner != "" {
+		owner = "leaseOwner = :owner"
+		values[":owner"] = &types.AttributeValueMemberS{Value: claim.Owner}
+	}
+	return condition{
+		expression: aws.String("inProgress = :inProgress AND " + owner +
+			" AND fencingToken = :token"),
+		values: values,
+		fenced: true,
+	}
+}
+
+func pk(id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		pkAttr: &types.AttributeValueMemberS{Value: id},
+	}
+}
+
+// item is the representation of the idempo.Record in the table.
+type item struct {
+	PK            string `dynamodbav:"pk"`
+	InputHash     string `dynamodbav:"inputHash"`
+	SuccessOutput bool   `dynamodbav:"successOutput"`
+	Output        []byte `dynamodbav:"output"`
+	SchemaVersion int    `dynamodbav:"schemaVersion"`
+	Scope         string `dynamodbav:"scope,omitempty"`
+	// ExpiresAt is the native TTL attribute in epoch seconds, omitted for
+	// records that never expire.
+	ExpiresAt int64 `dynamodbav:"expiresAt,omitempty"`
+	// ExpiresAtNano keeps the precision of the Record.ExpiresAt.
+	ExpiresAtNano  int64  `dynamodbav:"expiresAtNano,omitempty"`
+	InProgress     bool   `dynamodbav:"inProgress,omitempty"`
+	LeaseOwner     string `dynamodbav:"leaseOwner,omitempty"`
+	LeaseExpiresAt int64  `dynamodbav:"leaseExpiresAt,omitempty"`
+	FencingToken   uint64 `dynamodbav:"fencingToken,omitempty"`
+}
+
+func newItem(record idempo.Record) (it item) {
+	it = item{
+		PK:            record.ID,
+		InputHash:     record.InputHash,
+		SuccessOutput: record.SuccessOutput,
+		Output:        record.Output,
+		SchemaVersion: record.SchemaVersion,
+		Scope:         record.Scope,
+		InProgress:    record.InProgress,
+		LeaseOwner:    record.LeaseOwner,
+		FencingToken:  record.FencingToken,
+	}
+	if !record.ExpiresAt.IsZero() {
+		// Rounded up, so DynamoDB never removes the record before it expires.
+		it.ExpiresAt = record.ExpiresAt.Add(time.Second - 1).Unix()
+		it.ExpiresAtNano = record.ExpiresAt.UnixNano()
+	}
+	if !record.LeaseExpiresAt.IsZero() {
+		it.LeaseExpiresAt = record.LeaseExpiresAt.UnixNano()
+	}
+	return
+}
+
+func (it item) record() (record idempo.Record) {
+	record = idempo.Record{
+		ID:            it.PK,
+		InputHash:     it.InputHash,
+		SuccessOutput: it.SuccessOutput,
+		Output:        it.Output,
+		SchemaVersion: it.SchemaVersion,
+		Scope:         it.Scope,
+		InProgress:    it.InProgress,
+		LeaseOwner:    it.LeaseOwner,
+		FencingToken:  it.FencingToken,
+	}
+	if it.ExpiresAtNano != 0 {
+		record.ExpiresAt = time.Unix(0, it.ExpiresAtNano)
+	}
+	if it.LeaseExpiresAt != 0 {
+		record.LeaseExpiresAt = time.Unix(0, it.LeaseExpiresAt)
+	}
+	return
+}
@@ -0,0 +1,65 @@
+package dynamodb
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Tx accumulates the writes of a UnitOfWork, which are then committed with a
+// single TransactWriteItems call.
+//
+// Reads are not part of the transaction. Repositories should read with the
+// Client directly and guard their writes with condition expressions.
+type Tx struct {
+	client *dynamodb.Client
+	// items holds the accumulated writes, nil for the removed ones.
+	items []*types.TransactWriteItem
+	// fenced marks the writes conditioned on a lease (see
+	// idempo.FencedStore).
+	fenced []bool
+}
+
+// Client returns the DynamoDB client.
+func (tx *Tx) Client() *dynamodb.Client {
+	return tx.client
+}
+
+// Add adds writes to the transaction.
+func (tx *Tx) Add(items ...types.TransactWriteItem) {
+	for i := range items {
+		tx.add(items[i])
+	}
+}
+
+func (tx *Tx) add(item types.TransactWriteItem) (index int) {
+	tx.items = append(tx.items, &item)
+	tx.fenced = append(tx.fenced, false)
+	return len(tx.items) - 1
+}
+
+func (tx *Tx) set(index int, item types.TransactWriteItem) {
+	tx.items[index] = &item
+}
+
+func (tx *Tx) fence(index int, fenced bool) {
+	tx.fenced[index] = fenced
+}
+
+func (tx *Tx) remove(index int) {
+	tx.items[index] = nil
+	tx.fenced[index] = false
+}
+
+// transactItems returns the writes to commit. fenced marks the conditioned
+// on a lease ones.
+func (tx *Tx) transactItems() (items []types.TransactWriteItem,
+	fenced []bool,
+) {
+	for i, item := range tx.items {
+		if item != nil {
+			items = append(items, *item)
+			fenced = append(fenced, tx.fenced[i])
+		}
+	}
+	return
+}
@@ -0,0 +1,106 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// ConflictClassifier is an idempo.RetryClassifier that classifies canceled
+// transactions as retryable if they were canceled because of a conflict, i.e.
+// a failed condition or a concurrent transaction on the same item.
+//
+// With it, the loser of a race for the same idempotency key is retried and
+// receives the winner's outcome as a replay.
+var ConflictClassifier = idempo.RetryClassifierFunc(func(err error) bool {
+	var canceledErr *types.TransactionCanceledException
+	if !errors.As(err, &canceledErr) {
+		return false
+	}
+	for _, reason := range canceledErr.CancellationReasons {
+		if reason.Code == nil {
+			continue
+		}
+		switch *reason.Code {
+		case "ConditionalCheckFailed", "TransactionConflict":
+			return true
+		}
+	}
+	return false
+})
+
+// NewUnitOfWork is the constructor for the UnitOfWork.
+func NewUnitOfWork[T idempo.UOWRepos](client *dynamodb.Client,
+	factory RepositoryBundleFactory[T],
+) *UnitOfWork[T] {
+	return &UnitOfWork[T]{
+		client:  client,
+		factory: factory,
+	}
+}
+
+// UnitOfWork manages the transaction lifecycle for DynamoDB.
+// It is generic over the Repository Bundle type (T).
+//
+// The writes made by the work function are accumulated in the Tx and
+// committed together, with a single TransactWriteItems call, so DynamoDB
+// limits apply (e.g. up to 100 items per transaction).
+type UnitOfWork[T idempo.UOWRepos] struct {
+	client *dynamodb.Client
+	// factory is the external function used to construct the bundle (T)
+	// for a specific transaction (tx).
+	factory RepositoryBundleFactory[T]
+}
+
+// Execute executes the work function and commits its writes.
+func (u *UnitOfWork[T]) Execute(fn func(repos T) error) error {
+	return u.ExecuteContext(context.Background(),
+		func(ctx context.Context, repos T) error {
+			return fn(repos)
+		})
+}
+
+// ExecuteContext is like Execute, but commits the writes with the given
+// context.
+func (u *UnitOfWork[T]) ExecuteContext(ctx context.Context,
+	fn func(ctx context.Context, repos T) error,
+) (err error) {
+	tx := &Tx{client: u.client}
+	if err = fn(ctx, u.factory(tx)); err != nil {
+		return
+	}
+	items, fenced := tx.transactItems()
+	if len(items) == 0 {
+		return
+	}
+	_, err = u.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	if leaseLost(err, fenced) {
+		return fmt.Errorf("%w: %w", idempo.ErrLeaseLost, err)
+	}
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"dynamodb transact write error: %w", err)
+	}
+	return
+}
+
+// leaseLost reports whether the transaction was canceled because the
+// condition of a fenced write failed.
+func leaseLost(err error, fenced []bool) bool {
+	var canceledErr *types.TransactionCanceledException
+	if !errors.As(err, &canceledErr) {
+		return false
+	}
+	for i, reason := range canceledErr.CancellationReasons {
+		if i < len(fenced) && fenced[i] && reason.Code != nil &&
+			*reason.Code == "ConditionalCheckFailed" {
+			return true
+		}
+	}
+	return false
+}
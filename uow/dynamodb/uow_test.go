@@ -0,0 +1,199 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+	serializer "github.com/ymz-ncnk/idempo-go/serializer/json"
+	"github.com/ymz-ncnk/idempo-go/uow/uowtest"
+)
+
+// TestUnitOfWork runs against DynamoDB Local, whose endpoint is specified by
+// the IDEMPO_DYNAMODB_ENDPOINT environment variable, e.g. the one started with
+// "docker compose up -d dynamodb".
+func TestUnitOfWork(t *testing.T) {
+	endpoint := os.Getenv("IDEMPO_DYNAMODB_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("IDEMPO_DYNAMODB_ENDPOINT is not set, run " +
+			"\"docker compose up -d dynamodb\" and set " +
+			"IDEMPO_DYNAMODB_ENDPOINT=http://localhost:8000")
+	}
+	var (
+		ctx    = context.Background()
+		client = dynamodb.New(dynamodb.Options{
+			Region:       "us-east-1",
+			BaseEndpoint: aws.String(endpoint),
+			Credentials:  credentials.NewStaticCredentialsProvider("local", "local", ""),
+		})
+		suffix      = fmt.Sprint(time.Now().UnixNano())
+		recordTable = DynamoDBIdempotencyTableName + "_" + suffix
+		orderTable  = "orders_" + suffix
+	)
+	assertfatal.EqualError(CreateTable(ctx, client, recordTable), nil, t)
+	assertfatal.EqualError(CreateTable(ctx, client, orderTable), nil, t)
+
+	var (
+		errFailed  = errors.New("failed")
+		unitOfWork = NewUnitOfWork(client, func(tx *Tx) repos {
+			return repos{NewIdempotencyStore(tx, recordTable), tx}
+		})
+		wrapper = idempo.NewWrapper[repos, input](idempo.Config[repos, string, string]{
+			UnitOfWork: unitOfWork,
+			SuccessSer: serializer.JSONSerializer[string]{},
+			FailureSer: serializer.JSONSerializer[string]{},
+			ErrorToFailure: func(err error) (idempo.Persistence, string) {
+				return idempo.PersistNone, ""
+			},
+			RetryPolicy: idempo.RetryPolicy{Classifier: ConflictClassifier},
+		})
+		calls  int
+		action = func(ctx context.Context, repos repos, idempotencyKey string,
+			in input,
+		) (orderID string, err error) {
+			calls++
+			repos.tx.Add(types.TransactWriteItem{Put: &types.Put{
+				TableName: aws.String(orderTable),
+				Item:      pk(idempotencyKey),
+			}})
+			if in == "fail" {
+				return "", errFailed
+			}
+			return idempotencyKey, nil
+		}
+		count = func(table, id string) int {
+			output, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+				TableName:      aws.String(table),
+				Key:            pk(id),
+				ConsistentRead: aws.Bool(true),
+			})
+			assertfatal.EqualError(err, nil, t)
+			if output.Item == nil {
+				return 0
+			}
+			return 1
+		}
+	)
+
+	t.Run("Should replay the committed outcome", func(t *testing.T) {
+		orderID, err := wrapper.Wrap(ctx, "order-1", "ok", action)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(orderID, "order-1", t)
+		assertfatal.Equal(count(orderTable, "order-1"), 1, t)
+
+		orderID, err = wrapper.Wrap(ctx, "order-1", "ok", action)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(orderID, "order-1", t)
+		assertfatal.Equal(calls, 1, t)
+
+		_, err = wrapper.Wrap(ctx, "order-1", "other", action)
+		assertfatal.EqualError(err, idempo.ErrHashMismatch, t)
+	})
+
+	t.Run("Should not write anything if the Action fails", func(t *testing.T) {
+		_, err := wrapper.Wrap(ctx, "order-2", "fail", action)
+		assertfatal.EqualError(err, errFailed, t)
+		assertfatal.Equal(count(orderTable, "order-2"), 0, t)
+		assertfatal.Equal(count(recordTable, "order-2"), 0, t)
+	})
+
+	t.Run("Should reject a concurrently saved record", func(t *testing.T) {
+		err := unitOfWork.Execute(func(r repos) error {
+			if err := r.store.Save(ctx, idempo.Record{ID: "order-3"}); err != nil {
+				return err
+			}
+			// Another unit of work saves the same record in the meantime.
+			return unitOfWork.Execute(func(r repos) error {
+				return r.store.Save(ctx, idempo.Record{ID: "order-3"})
+			})
+		})
+		assertfatal.Equal(ConflictClassifier.Retryable(err), true, t)
+	})
+
+	t.Run("Should coalesce writes of the same record", func(t *testing.T) {
+		err := unitOfWork.Execute(func(r repos) (err error) {
+			if err = r.store.(idempo.Deleter).Delete(ctx, "order-1"); err != nil {
+				return
+			}
+			return r.store.Save(ctx, idempo.Record{ID: "order-1", InputHash: "new"})
+		})
+		assertfatal.EqualError(err, nil, t)
+		err = unitOfWork.Execute(func(r repos) error {
+			record, err := r.store.Get(ctx, "order-1")
+			assertfatal.EqualError(err, nil, t)
+			assertfatal.Equal(record.InputHash, "new", t)
+			return nil
+		})
+		assertfatal.EqualError(err, nil, t)
+	})
+
+	t.Run("Should re-execute an expired record only once", func(t *testing.T) {
+		expiring := idempo.NewWrapper[repos, input](idempo.Config[repos, string, string]{
+			UnitOfWork: unitOfWork,
+			SuccessSer: serializer.JSONSerializer[string]{},
+			FailureSer: serializer.JSONSerializer[string]{},
+			ErrorToFailure: func(err error) (idempo.Persistence, string) {
+				return idempo.PersistFor(time.Millisecond), err.Error()
+			},
+			FailureToError: func(failure string) error {
+				return errors.New(failure)
+			},
+		})
+		_, err := expiring.Wrap(ctx, "order-4", "ok", func(ctx context.Context,
+			repos repos, idempotencyKey string, in input,
+		) (string, error) {
+			return "", errFailed
+		})
+		assertfatal.EqualError(err, errFailed, t)
+		time.Sleep(10 * time.Millisecond)
+
+		var (
+			executions int
+			reexecute  func(ctx context.Context, repos repos,
+				idempotencyKey string, in input) (string, error)
+		)
+		reexecute = func(ctx context.Context, repos repos, idempotencyKey string,
+			in input,
+		) (orderID string, err error) {
+			executions++
+			orderID = fmt.Sprint("order-", executions)
+			if executions == 1 {
+				// Another re-execution of the expired record commits in the
+				// meantime.
+				_, err = wrapper.Wrap(context.Background(), idempotencyKey, in,
+					reexecute)
+			}
+			return
+		}
+		orderID, err := wrapper.Wrap(ctx, "order-4", "ok", reexecute)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(orderID, "order-2", t)
+		assertfatal.Equal(executions, 2, t)
+	})
+
+	uowtest.TestStore(t, unitOfWork)
+}
+
+type repos struct {
+	store idempo.Store
+	tx    *Tx
+}
+
+func (r repos) IdempotencyStore() idempo.Store {
+	return r.store
+}
+
+type input string
+
+func (in input) Hash() (string, error) {
+	return string(in), nil
+}
@@ -0,0 +1,206 @@
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// FSIdempotencyCollectionName is the collection name for idempotency records.
+const FSIdempotencyCollectionName = "idempotency_records"
+
+// ErrDuplicateKey is returned by the IdempotencyStore when a record with the
+// same ID has already been saved.
+var ErrDuplicateKey = errors.New(idempo.ErrorPrefix + "fs duplicate key")
+
+// NewIdempotencyStore returns a new file-system idempotency store.
+func NewIdempotencyStore(tx *Tx) idempo.Store {
+	return &IdempotencyStore{tx}
+}
+
+// IdempotencyStore implements the app.IdempotencyStore interface.
+//
+// Each record is stored as a JSON file, named after the encoded record ID.
+type IdempotencyStore struct {
+	tx *Tx
+}
+
+// Get retrieves an IdempotencyRecord by key.
+func (s *IdempotencyStore) Get(ctx context.Context, id string) (
+	record idempo.Record, err error,
+) {
+	data, err := s.tx.ReadFile(FSIdempotencyCollectionName, id)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = idempo.ErrIdempotencyRecordNotFound
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"fs get error: %w", err)
+		return
+	}
+	if err = json.Unmarshal(data, &record); err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"fs get error: %w", err)
+		return
+	}
+	// Long IDs are hashed into file names.
+	if record.ID != id {
+		err = idempo.ErrIdempotencyRecordNotFound
+	}
+	return
+}
+
+// Save creates a new record. Returns ErrDuplicateKey if a record with the same
+// ID exists.
+func (s *IdempotencyStore) Save(ctx context.Context,
+	record idempo.Record,
+) (err error) {
+	_, err = s.Get(ctx, record.ID)
+	if err == nil {
+		return ErrDuplicateKey
+	}
+	if !errors.Is(err, idempo.ErrIdempotencyRecordNotFound) {
+		return
+	}
+	return s.write(record)
+}
+
+// Update replaces an existing record.
+func (s *IdempotencyStore) Update(ctx context.Context,
+	record idempo.Record,
+) (err error) {
+	if _, err = s.Get(ctx, record.ID); err != nil {
+		return
+	}
+	return s.write(record)
+}
+
+// Delete removes a record.
+func (s *IdempotencyStore) Delete(ctx context.Context, id string) (err error) {
+	if err = s.tx.RemoveFile(FSIdempotencyCollectionName, id); err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"fs delete error: %w", err)
+	}
+	return
+}
+
+// UpdateFenced replaces the in-progress record if it is held under the
+// claim. It is atomic, since transactions are serialized.
+func (s *IdempotencyStore) UpdateFenced(ctx context.Context, claim idempo.Claim,
+	record idempo.Record,
+) (err error) {
+	if err = s.checkClaim(ctx, claim, record.ID); err != nil {
+		return
+	}
+	return s.write(record)
+}
+
+// DeleteFenced removes the in-progress record if it is held under the claim.
+func (s *IdempotencyStore) DeleteFenced(ctx context.Context, claim idempo.Claim,
+	id string,
+) (err error) {
+	if err = s.checkClaim(ctx, claim, id); err != nil {
+		return
+	}
+	return s.Delete(ctx, id)
+}
+
+// write creates or replaces the record file.
+func (s *IdempotencyStore) write(record idempo.Record) (err error) {
+	data, err := json.Marshal(record)
+	if err == nil {
+		err = s.tx.WriteFile(FSIdempotencyCollectionName, record.ID, data)
+	}
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"fs save error: %w", err)
+	}
+	return
+}
+
+func (s *IdempotencyStore) checkClaim(ctx context.Context, claim idempo.Claim,
+	id string,
+) (err error) {
+	record, err := s.Get(ctx, id)
+	if errors.Is(err, idempo.ErrIdempotencyRecordNotFound) {
+		return idempo.ErrLeaseLost
+	}
+	if err != nil {
+		return
+	}
+	if !claim.Holds(record) {
+		return idempo.ErrLeaseLost
+	}
+	return
+}
+
+// List returns all records of the given scope.
+//
+// It reads all records, so it's meant for small directories.
+func (s *IdempotencyStore) List(ctx context.Context, scope string) (
+	records []idempo.Record, err error,
+) {
+	datas, err := s.tx.ReadAll(FSIdempotencyCollectionName)
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"fs list error: %w", err)
+		return
+	}
+	for _, data := range datas {
+		var record idempo.Record
+		if err = json.Unmarshal(data, &record); err != nil {
+			err = fmt.Errorf(idempo.ErrorPrefix+"fs list error: %w", err)
+			return
+		}
+		if record.Scope == scope {
+			records = append(records, record)
+		}
+	}
+	return
+}
+
+// Purge deletes all records of the given scope.
+func (s *IdempotencyStore) Purge(ctx context.Context, scope string) (err error) {
+	records, err := s.List(ctx, scope)
+	if err != nil {
+		return
+	}
+	for _, record := range records {
+		if err = s.Delete(ctx, record.ID); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// GetMany retrieves records by keys.
+func (s *IdempotencyStore) GetMany(ctx context.Context, ids []string) (
+	records map[string]idempo.Record, err error,
+) {
+	records = make(map[string]idempo.Record, len(ids))
+	for _, id := range ids {
+		var record idempo.Record
+		record, err = s.Get(ctx, id)
+		if err == idempo.ErrIdempotencyRecordNotFound {
+			err = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+		records[id] = record
+	}
+	return
+}
+
+// SaveMany creates new records.
+func (s *IdempotencyStore) SaveMany(ctx context.Context,
+	records []idempo.Record,
+) (err error) {
+	for _, record := range records {
+		if err = s.Save(ctx, record); err != nil {
+			return
+		}
+	}
+	return
+}
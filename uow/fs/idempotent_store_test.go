@@ -0,0 +1,150 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+	serializer "github.com/ymz-ncnk/idempo-go/serializer/json"
+	"github.com/ymz-ncnk/idempo-go/uow/uowtest"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		dir       = t.TempDir()
+		errFailed = errors.New("failed")
+		factory   = func(tx *Tx) repos {
+			return repos{NewIdempotencyStore(tx), tx}
+		}
+	)
+	unitOfWork, err := NewUnitOfWork(dir, factory)
+	assertfatal.EqualError(err, nil, t)
+
+	var (
+		wrapper = idempo.NewWrapper[repos, input](idempo.Config[repos, string, string]{
+			UnitOfWork: unitOfWork,
+			SuccessSer: serializer.JSONSerializer[string]{},
+			FailureSer: serializer.JSONSerializer[string]{},
+			ErrorToFailure: func(err error) (idempo.Persistence, string) {
+				return idempo.PersistNone, ""
+			},
+		})
+		calls  int
+		action = func(ctx context.Context, repos repos, idempotencyKey string,
+			in input,
+		) (orderID string, err error) {
+			calls++
+			err = repos.tx.WriteFile("orders", idempotencyKey, []byte(in))
+			if err != nil {
+				return
+			}
+			if in == "fail" {
+				return "", errFailed
+			}
+			return idempotencyKey, nil
+		}
+		exists = func(collection, key string) (ok bool) {
+			err := unitOfWork.Execute(func(r repos) (err error) {
+				_, err = r.tx.ReadFile(collection, key)
+				ok = err == nil
+				if errors.Is(err, fs.ErrNotExist) {
+					err = nil
+				}
+				return
+			})
+			assertfatal.EqualError(err, nil, t)
+			return
+		}
+	)
+
+	t.Run("Should replay the committed outcome", func(t *testing.T) {
+		for _, key := range []string{"order-1", "../" + strings.Repeat("Long", 100)} {
+			calls = 0
+			orderID, err := wrapper.Wrap(ctx, key, "ok", action)
+			assertfatal.EqualError(err, nil, t)
+			assertfatal.Equal(orderID, key, t)
+
+			orderID, err = wrapper.Wrap(ctx, key, "ok", action)
+			assertfatal.EqualError(err, nil, t)
+			assertfatal.Equal(orderID, key, t)
+			assertfatal.Equal(calls, 1, t)
+
+			_, err = wrapper.Wrap(ctx, key, "other", action)
+			assertfatal.EqualError(err, idempo.ErrHashMismatch, t)
+		}
+	})
+
+	t.Run("Should roll back the Action with its record", func(t *testing.T) {
+		_, err := wrapper.Wrap(ctx, "order-2", "fail", action)
+		assertfatal.EqualError(err, errFailed, t)
+		assertfatal.Equal(exists("orders", "order-2"), false, t)
+		assertfatal.Equal(exists(FSIdempotencyCollectionName, "order-2"), false, t)
+		entries, err := os.ReadDir(filepath.Join(dir, tmpDir))
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(len(entries), 0, t)
+	})
+
+	t.Run("Should fail to save a duplicate record", func(t *testing.T) {
+		err := unitOfWork.Execute(func(r repos) error {
+			return r.store.Save(ctx, idempo.Record{ID: "order-1"})
+		})
+		assertfatal.EqualError(err, ErrDuplicateKey, t)
+	})
+
+	t.Run("Should recover after a crash", func(t *testing.T) {
+		committed, err := begin(dir)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.EqualError(committed.WriteFile("orders", "order-3", nil), nil, t)
+		assertfatal.EqualError(committed.RemoveFile("orders", "order-1"), nil, t)
+		_, err = committed.writeJournal()
+		assertfatal.EqualError(err, nil, t)
+
+		uncommitted, err := begin(dir)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.EqualError(uncommitted.WriteFile("orders", "order-4", nil), nil,
+			t)
+
+		unitOfWork, err = NewUnitOfWork(dir, factory)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(exists("orders", "order-3"), true, t)
+		assertfatal.Equal(exists("orders", "order-1"), false, t)
+		assertfatal.Equal(exists("orders", "order-4"), false, t)
+		_, err = os.Stat(filepath.Join(dir, journalFile))
+		assertfatal.Equal(errors.Is(err, fs.ErrNotExist), true, t)
+	})
+
+	uowtest.TestStore(t, unitOfWork)
+}
+
+func TestEncodeName(t *testing.T) {
+	for _, key := range []string{"", "a/b", "..", "CON", "Key", "key",
+		strings.Repeat("k", 1000)} {
+		name := encodeName(key)
+		assertfatal.Equal(len(name) <= maxNameLen, true, t)
+		assertfatal.Equal(strings.Trim(name, "0123456789abcdefghijklmnopqrstuvwxyz"),
+			"", t)
+	}
+	assertfatal.Equal(encodeName("Key") != encodeName("key"), true, t)
+}
+
+type repos struct {
+	store idempo.Store
+	tx    *Tx
+}
+
+func (r repos) IdempotencyStore() idempo.Store {
+	return r.store
+}
+
+type input string
+
+func (in input) Hash() (string, error) {
+	return string(in), nil
+}
@@ -0,0 +1,30 @@
+package fs
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+)
+
+// maxNameLen limits the length of encoded file names, well below the 255
+// bytes allowed by common file systems.
+const maxNameLen = 200
+
+// nameEncoding is lowercase, so encoded names don't collide on
+// case-insensitive file systems.
+var nameEncoding = base32.NewEncoding(
+	strings.ToLower("0123456789ABCDEFGHIJKLMNOPQRSTUV")).WithPadding(
+	base32.NoPadding)
+
+// encodeName encodes the key into a file name, which contains only lowercase
+// letters and digits. Keys too long to be encoded are replaced with their
+// SHA-256 hash, the prefix keeps both kinds of names apart.
+func encodeName(key string) string {
+	name := "k" + nameEncoding.EncodeToString([]byte(key))
+	if len(name) <= maxNameLen {
+		return name
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "h" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,292 @@
+package fs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+const (
+	dataDir     = "data"
+	tmpDir      = "tmp"
+	journalFile = "journal"
+)
+
+// Tx is a transaction of the UnitOfWork. It stores files, identified by a
+// collection and a key, e.g. a table and a primary key.
+//
+// Writes are staged in a temporary directory and become visible to other
+// transactions only after the commit. Tx is not safe for concurrent use.
+type Tx struct {
+	dir     string
+	stage   string
+	pending map[file]bool
+}
+
+// begin starts a transaction with a new stage directory.
+func begin(dir string) (tx *Tx, err error) {
+	stage, err := os.MkdirTemp(filepath.Join(dir, tmpDir), "tx-")
+	if err != nil {
+		return
+	}
+	tx = &Tx{dir: dir, stage: filepath.Base(stage), pending: map[file]bool{}}
+	return
+}
+
+// file is a file of the Tx, with the encoded collection and key. It maps to
+// true if the file is written and to false if it is removed.
+type file struct {
+	Collection string `json:"collection"`
+	Name       string `json:"name"`
+}
+
+// ReadFile returns the content of the file. The error satisfies
+// errors.Is(err, fs.ErrNotExist) if there is no such file.
+func (tx *Tx) ReadFile(collection, key string) (data []byte, err error) {
+	f := file{encodeName(collection), encodeName(key)}
+	write, ok := tx.pending[f]
+	switch {
+	case !ok:
+		return os.ReadFile(tx.dataPath(f))
+	case write:
+		return os.ReadFile(tx.stagePath(f))
+	default:
+		return nil, fs.ErrNotExist
+	}
+}
+
+// ReadAll returns the contents of all files of the collection, in no
+// particular order.
+func (tx *Tx) ReadAll(collection string) (datas [][]byte, err error) {
+	c := encodeName(collection)
+	entries, err := os.ReadDir(filepath.Join(tx.dir, dataDir, c))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	err = nil
+	seen := make(map[file]struct{}, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		f := file{c, entry.Name()}
+		seen[f] = struct{}{}
+		if err = tx.appendFile(&datas, f); err != nil {
+			return
+		}
+	}
+	for f := range tx.pending {
+		if _, ok := seen[f]; ok || f.Collection != c {
+			continue
+		}
+		if err = tx.appendFile(&datas, f); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// WriteFile stages the file to be created or replaced on commit.
+func (tx *Tx) WriteFile(collection, key string, data []byte) (err error) {
+	f := file{encodeName(collection), encodeName(key)}
+	if err = os.MkdirAll(filepath.Dir(tx.stagePath(f)), 0o755); err != nil {
+		return
+	}
+	if err = writeFile(tx.stagePath(f), data); err != nil {
+		return
+	}
+	tx.pending[f] = true
+	return
+}
+
+// RemoveFile stages the file to be removed on commit. Removing a
+// non-existent file is not an error.
+func (tx *Tx) RemoveFile(collection, key string) (err error) {
+	f := file{encodeName(collection), encodeName(key)}
+	if tx.pending[f] {
+		if err = os.Remove(tx.stagePath(f)); err != nil {
+			return
+		}
+	}
+	tx.pending[f] = false
+	return
+}
+
+func (tx *Tx) appendFile(datas *[][]byte, f file) (err error) {
+	write, ok := tx.pending[f]
+	if ok && !write {
+		return
+	}
+	path := tx.dataPath(f)
+	if write {
+		path = tx.stagePath(f)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	*datas = append(*datas, data)
+	return
+}
+
+func (tx *Tx) dataPath(f file) string {
+	return filepath.Join(tx.dir, dataDir, f.Collection, f.Name)
+}
+
+func (tx *Tx) stagePath(f file) string {
+	return filepath.Join(tx.dir, tmpDir, tx.stage, f.Collection, f.Name)
+}
+
+// commit makes the staged writes durable with the journal and then applies
+// them. Once the journal is written, the transaction is committed, if
+// applying fails, it is completed by recoverDir.
+func (tx *Tx) commit() (err error) {
+	if len(tx.pending) == 0 {
+		return
+	}
+	j, err := tx.writeJournal()
+	if err != nil {
+		return
+	}
+	return j.apply(tx.dir)
+}
+
+// writeJournal syncs the staged files and atomically writes the journal.
+func (tx *Tx) writeJournal() (j journal, err error) {
+	j.Stage = tx.stage
+	for f, write := range tx.pending {
+		if write {
+			j.Writes = append(j.Writes, f)
+			if err = syncDir(filepath.Dir(tx.stagePath(f))); err != nil {
+				return
+			}
+		} else {
+			j.Removes = append(j.Removes, f)
+		}
+	}
+	data, err := json.Marshal(j)
+	if err != nil {
+		return
+	}
+	tmpPath := filepath.Join(tx.dir, journalFile+".tmp")
+	if err = writeFile(tmpPath, data); err != nil {
+		return
+	}
+	if err = os.Rename(tmpPath, filepath.Join(tx.dir, journalFile)); err != nil {
+		return
+	}
+	err = syncDir(tx.dir)
+	return
+}
+
+// rollback discards the staged writes.
+func (tx *Tx) rollback() error {
+	return os.RemoveAll(filepath.Join(tx.dir, tmpDir, tx.stage))
+}
+
+// journal lists the writes and removals of a committed transaction.
+type journal struct {
+	Stage   string `json:"stage"`
+	Writes  []file `json:"writes"`
+	Removes []file `json:"removes"`
+}
+
+// apply moves the staged files of the journal into place and then removes
+// the journal. It can be repeated, e.g. after a crash.
+func (j journal) apply(dir string) (err error) {
+	tx := &Tx{dir: dir, stage: j.Stage}
+	dirs := map[string]struct{}{}
+	for _, f := range j.Writes {
+		if err = os.MkdirAll(filepath.Dir(tx.dataPath(f)), 0o755); err != nil {
+			return
+		}
+		err = os.Rename(tx.stagePath(f), tx.dataPath(f))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return
+		}
+		dirs[filepath.Dir(tx.dataPath(f))] = struct{}{}
+	}
+	for _, f := range j.Removes {
+		err = os.Remove(tx.dataPath(f))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return
+		}
+		dirs[filepath.Dir(tx.dataPath(f))] = struct{}{}
+	}
+	for d := range dirs {
+		if err = syncDir(d); err != nil {
+			return
+		}
+	}
+	if err = os.Remove(filepath.Join(dir, journalFile)); err != nil {
+		return
+	}
+	if err = syncDir(dir); err != nil {
+		return
+	}
+	return tx.rollback()
+}
+
+// recoverDir completes the transaction committed by the journal, if any, and
+// discards the uncommitted ones.
+func recoverDir(dir string) (err error) {
+	data, err := os.ReadFile(filepath.Join(dir, journalFile))
+	switch {
+	case err == nil:
+		var j journal
+		if err = json.Unmarshal(data, &j); err != nil {
+			return fmt.Errorf(idempo.ErrorPrefix+"fs corrupted journal: %w", err)
+		}
+		if err = j.apply(dir); err != nil {
+			return
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return
+	}
+	err = os.Remove(filepath.Join(dir, journalFile+".tmp"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err = os.RemoveAll(filepath.Join(dir, tmpDir)); err != nil {
+		return
+	}
+	return os.MkdirAll(filepath.Join(dir, tmpDir), 0o755)
+}
+
+// writeFile writes and syncs the file.
+func writeFile(path string, data []byte) (err error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return
+}
+
+// syncDir syncs the directory, so renames and removals in it are durable.
+// Directories can't be synced on Windows, where it's a no-op.
+func syncDir(path string) (err error) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	d, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+	return
+}
@@ -0,0 +1,97 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// NewUnitOfWork is the constructor for the UnitOfWork. It creates the
+// directory if needed and completes or discards transactions interrupted by
+// a crash.
+func NewUnitOfWork[T idempo.UOWRepos](dir string,
+	factory RepositoryBundleFactory[T],
+) (unitOfWork *UnitOfWork[T], err error) {
+	if err = os.MkdirAll(filepath.Join(dir, dataDir), 0o755); err != nil {
+		return
+	}
+	if err = recoverDir(dir); err != nil {
+		return
+	}
+	unitOfWork = &UnitOfWork[T]{
+		dir:     dir,
+		factory: factory,
+		writer:  make(chan struct{}, 1),
+	}
+	return
+}
+
+// UnitOfWork manages the transaction lifecycle for a directory.
+// It is generic over the Repository Bundle type (T).
+//
+// Files are kept in the data subdirectory, one per key. The writes of a
+// transaction are staged in the tmp subdirectory and committed with a
+// journal: once it is written, the staged files are renamed into place. All
+// files are fsynced, so a committed transaction survives a crash and an
+// uncommitted one leaves no trace.
+//
+// Transactions are serialized within the process. The directory must not be
+// shared by several UnitOfWorks, including ones in other processes.
+type UnitOfWork[T idempo.UOWRepos] struct {
+	dir string
+	// factory is the external function used to construct the bundle (T)
+	// for a specific transaction (tx).
+	factory RepositoryBundleFactory[T]
+	// writer admits one transaction at a time, so waiting for it can be
+	// cancelled with the context.
+	writer chan struct{}
+	// broken is true if applying a committed transaction has failed, so it
+	// must be completed before the next one starts.
+	broken bool
+}
+
+// Execute starts a transaction, executes the work function, and handles
+// commit/rollback.
+func (u *UnitOfWork[T]) Execute(fn func(repos T) error) error {
+	return u.ExecuteContext(context.Background(),
+		func(ctx context.Context, repos T) error {
+			return fn(repos)
+		})
+}
+
+// ExecuteContext is like Execute, but passes the given context to the work
+// function and doesn't commit if it's done. Waiting for the preceding
+// transaction ends when ctx is done as well.
+func (u *UnitOfWork[T]) ExecuteContext(ctx context.Context,
+	fn func(ctx context.Context, repos T) error,
+) (err error) {
+	select {
+	case u.writer <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-u.writer }()
+	if u.broken {
+		if err = recoverDir(u.dir); err != nil {
+			return
+		}
+		u.broken = false
+	}
+	tx, err := begin(u.dir)
+	if err != nil {
+		return
+	}
+	defer tx.rollback()
+	if err = fn(ctx, u.factory(tx)); err != nil {
+		return
+	}
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if err = tx.commit(); err != nil {
+		u.broken = true
+	}
+	return
+}
@@ -0,0 +1,11 @@
+package gorm
+
+import (
+	"github.com/ymz-ncnk/idempo-go"
+	"gorm.io/gorm"
+)
+
+// RepositoryBundleFactory is a function that accepts a transaction-scoped
+// *gorm.DB (tx) and constructs the full application and idempotency
+// repository bundle (T) for that specific transaction.
+type RepositoryBundleFactory[T idempo.UOWRepos] func(tx *gorm.DB) T
@@ -0,0 +1,30 @@
+module github.com/ymz-ncnk/idempo-go/uow/gorm
+
+go 1.24.1
+
+require (
+	github.com/glebarez/sqlite v1.11.0
+	github.com/ymz-ncnk/assert v0.0.0-20250528151733-c41b2fca7933
+	github.com/ymz-ncnk/idempo-go v0.0.0-00010101000000-000000000000
+	gorm.io/gorm v1.31.1
+)
+
+require (
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/glebarez/go-sqlite v1.21.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/jinzhu/now v1.1.5 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/ncruces/go-strftime v1.0.0 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	golang.org/x/exp v0.0.0-20251023183803-a4bb9ffd2546 // indirect
+	golang.org/x/sys v0.37.0 // indirect
+	golang.org/x/text v0.24.0 // indirect
+	modernc.org/libc v1.67.6 // indirect
+	modernc.org/mathutil v1.7.1 // indirect
+	modernc.org/memory v1.11.0 // indirect
+	modernc.org/sqlite v1.46.0 // indirect
+)
+
+replace github.com/ymz-ncnk/idempo-go => ../..
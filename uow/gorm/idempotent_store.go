@@ -0,0 +1,264 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ymz-ncnk/idempo-go"
+	"gorm.io/gorm"
+)
+
+// GormIdempotencyTableName is the table name for idempotency records.
+const GormIdempotencyTableName = "idempotency_records"
+
+// Migrate creates or updates the idempotency records table.
+func Migrate(db *gorm.DB) (err error) {
+	if err = db.AutoMigrate(&RecordModel{}); err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"gorm migrate error: %w", err)
+	}
+	return
+}
+
+// NewIdempotencyStore returns a new GORM idempotency store.
+func NewIdempotencyStore(tx *gorm.DB) idempo.Store {
+	return &IdempotencyStore{tx}
+}
+
+// IdempotencyStore implements the app.IdempotencyStore interface.
+//
+// With the TranslateError option of the gorm.Config, Save fails with
+// gorm.ErrDuplicatedKey if a concurrent transaction has saved a record with
+// the same ID.
+type IdempotencyStore struct {
+	tx *gorm.DB
+}
+
+// Get retrieves an IdempotencyRecord by key.
+func (s *IdempotencyStore) Get(ctx context.Context, id string) (
+	record idempo.Record, err error,
+) {
+	var model RecordModel
+	err = s.tx.WithContext(ctx).Where("id = ?", id).Take(&model).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = idempo.ErrIdempotencyRecordNotFound
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"gorm get error: %w", err)
+		return
+	}
+	record = model.record()
+	return
+}
+
+// Save creates a new record.
+func (s *IdempotencyStore) Save(ctx context.Context,
+	record idempo.Record,
+) (err error) {
+	model := newRecordModel(record)
+	if err = s.tx.WithContext(ctx).Create(&model).Error; err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"gorm insert error: %w", err)
+	}
+	return
+}
+
+// Update replaces an existing record.
+func (s *IdempotencyStore) Update(ctx context.Context,
+	record idempo.Record,
+) (err error) {
+	// Some databases (e.g. MySQL) report only changed rows as affected, so
+	// existence is checked separately.
+	if _, err = s.Get(ctx, record.ID); err != nil {
+		return
+	}
+	model := newRecordModel(record)
+	err = s.tx.WithContext(ctx).Model(&model).Select("*").Updates(&model).Error
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"gorm update error: %w", err)
+	}
+	return
+}
+
+// Delete removes a record.
+func (s *IdempotencyStore) Delete(ctx context.Context, id string) (err error) {
+	err = s.tx.WithContext(ctx).Where("id = ?", id).Delete(&RecordModel{}).Error
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"gorm delete error: %w", err)
+	}
+	return
+}
+
+// UpdateFenced replaces the in-progress record if it is held under the claim.
+//
+// Fenced writes always change the row (at least its in_progress or
+// lease_expires_at column), so no affected rows mean that the lease was lost,
+// even on databases that report only changed rows as affected.
+func (s *IdempotencyStore) UpdateFenced(ctx context.Context, claim idempo.Claim,
+	record idempo.Record,
+) (err error) {
+	model := newRecordModel(record)
+	result := s.tx.WithContext(ctx).Model(&model).
+		Where(claimCondition, true, claim.Owner, claim.FencingToken).
+		Select("*").Updates(&model)
+	if result.Error != nil {
+		return fmt.Errorf(idempo.ErrorPrefix+"gorm update error: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		err = idempo.ErrLeaseLost
+	}
+	return
+}
+
+// DeleteFenced removes the in-progress record if it is held under the claim.
+func (s *IdempotencyStore) DeleteFenced(ctx context.Context, claim idempo.Claim,
+	id string,
+) (err error) {
+	result := s.tx.WithContext(ctx).Where("id = ?", id).
+		Where(claimCondition, true, claim.Owner, claim.FencingToken).
+		Delete(&RecordModel{})
+	if result.Error != nil {
+		return fmt.Errorf(idempo.ErrorPrefix+"gorm delete error: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		err = idempo.ErrLeaseLost
+	}
+	return
+}
+
+// List returns all records of the given scope.
+func (s *IdempotencyStore) List(ctx context.Context, scope string) (
+	records []idempo.Record, err error,
+) {
+	return s.find(ctx, "scope = ?", scope)
+}
+
+// Purge deletes all records of the given scope.
+func (s *IdempotencyStore) Purge(ctx context.Context, scope string) (err error) {
+	err = s.tx.WithContext(ctx).Where("scope = ?", scope).
+		Delete(&RecordModel{}).Error
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"gorm purge error: %w", err)
+	}
+	return
+}
+
+// GetMany retrieves records by keys.
+func (s *IdempotencyStore) GetMany(ctx context.Context, ids []string) (
+	records map[string]idempo.Record, err error,
+) {
+	records = make(map[string]idempo.Record, len(ids))
+	if len(ids) == 0 {
+		return
+	}
+	list, err := s.find(ctx, "id IN ?", ids)
+	if err != nil {
+		return
+	}
+	for _, record := range list {
+		records[record.ID] = record
+	}
+	return
+}
+
+// SaveMany creates new records.
+func (s *IdempotencyStore) SaveMany(ctx context.Context,
+	records []idempo.Record,
+) (err error) {
+	if len(records) == 0 {
+		return
+	}
+	models := make([]RecordModel, len(records))
+	for i, record := range records {
+		models[i] = newRecordModel(record)
+	}
+	if err = s.tx.WithContext(ctx).Create(&models).Error; err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"gorm insert error: %w", err)
+	}
+	return
+}
+
+func (s *IdempotencyStore) find(ctx context.Context, query string,
+	args ...any,
+) (records []idempo.Record, err error) {
+	var models []RecordModel
+	if err = s.tx.WithContext(ctx).Where(query, args...).Find(&models).Error; err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"gorm find error: %w", err)
+		return
+	}
+	records = make([]idempo.Record, len(models))
+	for i, model := range models {
+		records[i] = model.record()
+	}
+	return
+}
+
+// claimCondition matches the in-progress record held under the claim.
+const claimCondition = "in_progress = ? AND lease_owner = ? AND fencing_token = ?"
+
+// RecordModel is the GORM model of the idempo.Record.
+type RecordModel struct {
+	ID             string `gorm:"primaryKey;size:512"`
+	InputHash      string `gorm:"size:255;not null"`
+	SuccessOutput  bool   `gorm:"not null"`
+	Output         []byte
+	SchemaVersion  int    `gorm:"not null;default:0"`
+	Scope          string `gorm:"size:512;not null;default:'';index"`
+	ExpiresAt      *time.Time
+	InProgress     bool   `gorm:"not null;default:false"`
+	LeaseOwner     string `gorm:"size:255;not null;default:''"`
+	LeaseExpiresAt *time.Time
+	FencingToken   uint64 `gorm:"not null;default:0"`
+}
+
+// TableName returns GormIdempotencyTableName.
+func (RecordModel) TableName() string {
+	return GormIdempotencyTableName
+}
+
+func newRecordModel(record idempo.Record) RecordModel {
+	return RecordModel{
+		ID:             record.ID,
+		InputHash:      record.InputHash,
+		SuccessOutput:  record.SuccessOutput,
+		Output:         record.Output,
+		SchemaVersion:  record.SchemaVersion,
+		Scope:          record.Scope,
+		ExpiresAt:      timePtr(record.ExpiresAt),
+		InProgress:     record.InProgress,
+		LeaseOwner:     record.LeaseOwner,
+		LeaseExpiresAt: timePtr(record.LeaseExpiresAt),
+		FencingToken:   record.FencingToken,
+	}
+}
+
+func (m RecordModel) record() idempo.Record {
+	return idempo.Record{
+		ID:             m.ID,
+		InputHash:      m.InputHash,
+		SuccessOutput:  m.SuccessOutput,
+		Output:         m.Output,
+		SchemaVersion:  m.SchemaVersion,
+		Scope:          m.Scope,
+		ExpiresAt:      timeValue(m.ExpiresAt),
+		InProgress:     m.InProgress,
+		LeaseOwner:     m.LeaseOwner,
+		LeaseExpiresAt: timeValue(m.LeaseExpiresAt),
+		FencingToken:   m.FencingToken,
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func timeValue(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
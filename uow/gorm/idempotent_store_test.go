@@ -0,0 +1,108 @@
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+	serializer "github.com/ymz-ncnk/idempo-go/serializer/json"
+	"github.com/ymz-ncnk/idempo-go/uow/uowtest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")),
+		&gorm.Config{TranslateError: true, Logger: logger.Discard})
+	assertfatal.EqualError(err, nil, t)
+	assertfatal.EqualError(Migrate(db), nil, t)
+	assertfatal.EqualError(db.AutoMigrate(&order{}), nil, t)
+
+	var (
+		ctx        = context.Background()
+		errFailed  = errors.New("failed")
+		unitOfWork = NewUnitOfWork(db, func(tx *gorm.DB) repos {
+			return repos{NewIdempotencyStore(tx), tx}
+		}, &sql.TxOptions{})
+		wrapper = idempo.NewWrapper[repos, input](idempo.Config[repos, string, string]{
+			UnitOfWork: unitOfWork,
+			SuccessSer: serializer.JSONSerializer[string]{},
+			FailureSer: serializer.JSONSerializer[string]{},
+			ErrorToFailure: func(err error) (idempo.Persistence, string) {
+				return idempo.PersistNone, ""
+			},
+		})
+		calls  int
+		action = func(ctx context.Context, repos repos, idempotencyKey string,
+			in input,
+		) (orderID string, err error) {
+			calls++
+			if err = repos.tx.Create(&order{ID: idempotencyKey}).Error; err != nil {
+				return
+			}
+			if in == "fail" {
+				return "", errFailed
+			}
+			return idempotencyKey, nil
+		}
+	)
+
+	t.Run("Should replay the committed outcome", func(t *testing.T) {
+		orderID, err := wrapper.Wrap(ctx, "order-1", "ok", action)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(orderID, "order-1", t)
+
+		orderID, err = wrapper.Wrap(ctx, "order-1", "ok", action)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(orderID, "order-1", t)
+		assertfatal.Equal(calls, 1, t)
+
+		_, err = wrapper.Wrap(ctx, "order-1", "other", action)
+		assertfatal.EqualError(err, idempo.ErrHashMismatch, t)
+	})
+
+	t.Run("Should roll back the Action with its record", func(t *testing.T) {
+		_, err := wrapper.Wrap(ctx, "order-2", "fail", action)
+		assertfatal.EqualError(err, errFailed, t)
+		var count int64
+		assertfatal.EqualError(db.Model(&order{}).Where("id = ?", "order-2").
+			Count(&count).Error, nil, t)
+		assertfatal.Equal(count, int64(0), t)
+		assertfatal.EqualError(db.Model(&RecordModel{}).Where("id = ?", "order-2").
+			Count(&count).Error, nil, t)
+		assertfatal.Equal(count, int64(0), t)
+	})
+
+	t.Run("Should fail to save a duplicate record", func(t *testing.T) {
+		err := unitOfWork.Execute(func(r repos) error {
+			return r.store.Save(ctx, idempo.Record{ID: "order-1"})
+		})
+		assertfatal.Equal(errors.Is(err, gorm.ErrDuplicatedKey), true, t)
+	})
+
+	uowtest.TestStore(t, unitOfWork)
+}
+
+type order struct {
+	ID string `gorm:"primaryKey"`
+}
+
+type repos struct {
+	store idempo.Store
+	tx    *gorm.DB
+}
+
+func (r repos) IdempotencyStore() idempo.Store {
+	return r.store
+}
+
+type input string
+
+func (in input) Hash() (string, error) {
+	return string(in), nil
+}
@@ -12,6 +12,14 @@ import (
 // MemDBIdempotencyTableName is the table name for idempotency records.
 const MemDBIdempotencyTableName = "idempotency_records"
 
+// MemDBScopeIndexName is the name of the table index on the Record.Scope field,
+// required by the List and Purge methods.
+const MemDBScopeIndexName = "scope"
+
+// ErrDuplicateKey is returned by the IdempotencyStore when a record with the
+// same ID has already been saved.
+var ErrDuplicateKey = errors.New(idempo.ErrorPrefix + "memdb duplicate key")
+
 // NewIdempotencyStore returns a new MemDB idempotency store.
 func NewIdempotencyStore(tx *memdb.Txn) idempo.Store {
 	return &IdempotencyStore{tx}
@@ -43,12 +51,139 @@ func (s *IdempotencyStore) Get(ctx context.Context, id string) (
 	return
 }
 
-// Save creates a new record.
+// Save creates a new record. Returns ErrDuplicateKey if a record with the same
+// ID exists.
 func (s *IdempotencyStore) Save(ctx context.Context,
 	record idempo.Record,
 ) (err error) {
-	if err := s.tx.Insert(MemDBIdempotencyTableName, record); err != nil {
+	_, err = s.Get(ctx, record.ID)
+	if err == nil {
+		return ErrDuplicateKey
+	}
+	if !errors.Is(err, idempo.ErrIdempotencyRecordNotFound) {
+		return
+	}
+	if err = s.tx.Insert(MemDBIdempotencyTableName, record); err != nil {
 		return fmt.Errorf(idempo.ErrorPrefix+"memdb insert error: %w", err)
 	}
 	return
 }
+
+// Update replaces an existing record.
+func (s *IdempotencyStore) Update(ctx context.Context,
+	record idempo.Record,
+) (err error) {
+	if _, err = s.Get(ctx, record.ID); err != nil {
+		return
+	}
+	if err = s.tx.Insert(MemDBIdempotencyTableName, record); err != nil {
+		return fmt.Errorf(idempo.ErrorPrefix+"memdb update error: %w", err)
+	}
+	return
+}
+
+// UpdateFenced replaces the in-progress record if it is held under the
+// claim. It is atomic, since MemDB allows a single write transaction at a
+// time.
+func (s *IdempotencyStore) UpdateFenced(ctx context.Context, claim idempo.Claim,
+	record idempo.Record,
+) (err error) {
+	if err = s.checkClaim(ctx, claim, record.ID); err != nil {
+		return
+	}
+	if err = s.tx.Insert(MemDBIdempotencyTableName, record); err != nil {
+		return fmt.Errorf(idempo.ErrorPrefix+"memdb update error: %w", err)
+	}
+	return
+}
+
+// DeleteFenced removes the in-progress record if it is held under the claim.
+func (s *IdempotencyStore) DeleteFenced(ctx context.Context, claim idempo.Claim,
+	id string,
+) (err error) {
+	if err = s.checkClaim(ctx, claim, id); err != nil {
+		return
+	}
+	return s.Delete(ctx, id)
+}
+
+func (s *IdempotencyStore) checkClaim(ctx context.Context, claim idempo.Claim,
+	id string,
+) (err error) {
+	record, err := s.Get(ctx, id)
+	if errors.Is(err, idempo.ErrIdempotencyRecordNotFound) {
+		return idempo.ErrLeaseLost
+	}
+	if err != nil {
+		return
+	}
+	if !claim.Holds(record) {
+		return idempo.ErrLeaseLost
+	}
+	return
+}
+
+// List returns all records of the given scope.
+func (s *IdempotencyStore) List(ctx context.Context, scope string) (
+	records []idempo.Record, err error,
+) {
+	it, err := s.tx.Get(MemDBIdempotencyTableName, MemDBScopeIndexName, scope)
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"memdb list error: %w", err)
+		return
+	}
+	for raw := it.Next(); raw != nil; raw = it.Next() {
+		records = append(records, raw.(idempo.Record))
+	}
+	return
+}
+
+// Purge deletes all records of the given scope.
+func (s *IdempotencyStore) Purge(ctx context.Context, scope string) (err error) {
+	_, err = s.tx.DeleteAll(MemDBIdempotencyTableName, MemDBScopeIndexName, scope)
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"memdb purge error: %w", err)
+	}
+	return
+}
+
+// Delete removes a record.
+func (s *IdempotencyStore) Delete(ctx context.Context, id string) (err error) {
+	_, err = s.tx.DeleteAll(MemDBIdempotencyTableName, "id", id)
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"memdb delete error: %w", err)
+	}
+	return
+}
+
+// GetMany retrieves records by keys.
+func (s *IdempotencyStore) GetMany(ctx context.Context, ids []string) (
+	records map[string]idempo.Record, err error,
+) {
+	records = make(map[string]idempo.Record, len(ids))
+	for _, id := range ids {
+		var record idempo.Record
+		record, err = s.Get(ctx, id)
+		if errors.Is(err, idempo.ErrIdempotencyRecordNotFound) {
+			err = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+		records[id] = record
+	}
+	return
+}
+
+// SaveMany creates new records.
+func (s *IdempotencyStore) SaveMany(ctx context.Context,
+	records []idempo.Record,
+) (err error) {
+	for _, record := range records {
+		if err = s.Save(ctx, record); err != nil {
+			return
+		}
+	}
+	return
+}
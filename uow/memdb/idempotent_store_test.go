@@ -0,0 +1,44 @@
+package memdb
+
+import (
+	"testing"
+
+	memdb "github.com/hashicorp/go-memdb"
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+	"github.com/ymz-ncnk/idempo-go/uow/uowtest"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	db, err := memdb.NewMemDB(&memdb.DBSchema{
+		Tables: map[string]*memdb.TableSchema{
+			MemDBIdempotencyTableName: {
+				Name: MemDBIdempotencyTableName,
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": {
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "ID"},
+					},
+					MemDBScopeIndexName: {
+						Name:         MemDBScopeIndexName,
+						AllowMissing: true,
+						Indexer:      &memdb.StringFieldIndex{Field: "Scope"},
+					},
+				},
+			},
+		},
+	})
+	assertfatal.EqualError(err, nil, t)
+	uowtest.TestStore(t, NewUnitOfWork(db, func(tx *memdb.Txn) repos {
+		return repos{NewIdempotencyStore(tx)}
+	}))
+}
+
+type repos struct {
+	store idempo.Store
+}
+
+func (r repos) IdempotencyStore() idempo.Store {
+	return r.store
+}
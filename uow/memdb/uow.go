@@ -1,6 +1,8 @@
 package memdb
 
 import (
+	"context"
+
 	memdb "github.com/hashicorp/go-memdb"
 	"github.com/ymz-ncnk/idempo-go"
 )
@@ -12,6 +14,7 @@ func NewUnitOfWork[T idempo.UOWRepos](db *memdb.MemDB,
 	return &UnitOfWork[T]{
 		db:      db,
 		factory: factory,
+		writer:  make(chan struct{}, 1),
 	}
 }
 
@@ -22,15 +25,36 @@ type UnitOfWork[T idempo.UOWRepos] struct {
 	// factory is the external function used to construct the bundle (T)
 	// for a specific transaction (tx).
 	factory RepositoryBundleFactory[T]
+	// writer admits one write transaction at a time, so waiting for it can be
+	// cancelled with the context.
+	writer chan struct{}
 }
 
 // Execute starts a transaction, executes the work function, and handles
 // commit/rollback.
 func (u *UnitOfWork[T]) Execute(fn func(repos T) error) error {
+	return u.ExecuteContext(context.Background(),
+		func(ctx context.Context, repos T) error {
+			return fn(repos)
+		})
+}
+
+// ExecuteContext is like Execute, but passes the given context to the work
+// function. MemDB allows a single write transaction at a time, waiting for it
+// ends when ctx is done.
+func (u *UnitOfWork[T]) ExecuteContext(ctx context.Context,
+	fn func(ctx context.Context, repos T) error,
+) error {
+	select {
+	case u.writer <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-u.writer }()
 	tx := u.db.Txn(true)
 	defer tx.Abort()
 	repos := u.factory(tx)
-	if err := fn(repos); err != nil {
+	if err := fn(ctx, repos); err != nil {
 		return err
 	}
 	tx.Commit()
@@ -0,0 +1,50 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ymz-ncnk/idempo-go"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const (
+	// transientTransactionError labels errors after which the whole
+	// transaction can be retried.
+	transientTransactionError = "TransientTransactionError"
+	// unknownTransactionCommitResult labels commit errors after which it's
+	// unknown whether the transaction was committed.
+	unknownTransactionCommitResult = "UnknownTransactionCommitResult"
+)
+
+// ErrDuplicateKey is returned by the IdempotencyStore when a record with the
+// same ID has already been saved, e.g. by a concurrent transaction.
+var ErrDuplicateKey = errors.New(idempo.ErrorPrefix + "mongo duplicate key")
+
+// RetryClassifier is an idempo.RetryClassifier that classifies transient
+// transaction errors and unknown commit results, left after the retries of
+// session.WithTransaction, and duplicate records as retryable. Duplicate keys
+// of other collections, e.g. written by the Action, are not retried.
+//
+// With it, the loser of a race for the same idempotency key is retried and
+// receives the winner's outcome as a replay.
+var RetryClassifier = idempo.RetryClassifierFunc(func(err error) bool {
+	if errors.Is(err, ErrDuplicateKey) {
+		return true
+	}
+	var labeledErr mongo.LabeledError
+	if !errors.As(err, &labeledErr) {
+		return false
+	}
+	return labeledErr.HasErrorLabel(transientTransactionError) ||
+		labeledErr.HasErrorLabel(unknownTransactionCommitResult)
+})
+
+// mapInsertError maps duplicate key errors of record inserts to
+// ErrDuplicateKey.
+func mapInsertError(err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %w", ErrDuplicateKey, err)
+	}
+	return fmt.Errorf(idempo.ErrorPrefix+"mongo insert error: %w", err)
+}
@@ -0,0 +1,14 @@
+package mongo
+
+import (
+	"context"
+
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// RepositoryBundleFactory is a function that accepts a session context
+// (sessCtx) and constructs the full application and idempotency repository
+// bundle (T) for that specific transaction. Repositories must pass sessCtx, or
+// a context derived from it, to collection operations, so they are executed
+// within the transaction.
+type RepositoryBundleFactory[T idempo.UOWRepos] func(sessCtx context.Context) T
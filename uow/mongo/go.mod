@@ -0,0 +1,24 @@
+module github.com/ymz-ncnk/idempo-go/uow/mongo
+
+go 1.24.1
+
+require (
+	github.com/ymz-ncnk/assert v0.0.0-20250528151733-c41b2fca7933
+	github.com/ymz-ncnk/idempo-go v0.0.0-00010101000000-000000000000
+	go.mongodb.org/mongo-driver/v2 v2.5.0
+)
+
+require (
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/klauspost/compress v1.18.0 // indirect
+	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
+	github.com/xdg-go/scram v1.2.0 // indirect
+	github.com/xdg-go/stringprep v1.0.4 // indirect
+	github.com/youmark/pkcs8 v0.0.0-20240726163527-a2c0da244d78 // indirect
+	golang.org/x/crypto v0.37.0 // indirect
+	golang.org/x/exp v0.0.0-20251023183803-a4bb9ffd2546 // indirect
+	golang.org/x/sync v0.17.0 // indirect
+	golang.org/x/text v0.24.0 // indirect
+)
+
+replace github.com/ymz-ncnk/idempo-go => ../..
@@ -0,0 +1,301 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ymz-ncnk/idempo-go"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// MongoIdempotencyCollectionName is the default collection name for
+// idempotency records.
+const MongoIdempotencyCollectionName = "idempotency_records"
+
+// EnsureIndexes creates the indexes required by the IdempotencyStore: a TTL
+// index on the expiresAt field, which removes expired records, and an index on
+// the scope field, used by the List and Purge methods. Record IDs are stored
+// in the unique _id field.
+func EnsureIndexes(ctx context.Context, coll *mongo.Collection) (err error) {
+	_, err = coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+		{
+			Keys: bson.D{{Key: "scope", Value: 1}},
+		},
+	})
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"mongo create indexes error: %w", err)
+	}
+	return
+}
+
+// NewIdempotencyStore returns a new MongoDB idempotency store, which executes
+// operations within the session of sessCtx.
+func NewIdempotencyStore(sessCtx context.Context,
+	coll *mongo.Collection,
+) idempo.Store {
+	return &IdempotencyStore{mongo.SessionFromContext(sessCtx), coll}
+}
+
+// IdempotencyStore implements the app.IdempotencyStore interface.
+//
+// MongoDB removes records with expired ExpiresAt in the background, once a
+// minute, so they may still be returned for a while.
+type IdempotencyStore struct {
+	session *mongo.Session
+	coll    *mongo.Collection
+}
+
+// Get retrieves an IdempotencyRecord by key.
+func (s *IdempotencyStore) Get(ctx context.Context, id string) (
+	record idempo.Record, err error,
+) {
+	var doc document
+	err = s.coll.FindOne(s.sessionContext(ctx), bson.D{{Key: "_id", Value: id}}).
+		Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		err = idempo.ErrIdempotencyRecordNotFound
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"mongo get error: %w", err)
+		return
+	}
+	record = doc.record()
+	return
+}
+
+// Save creates a new record. Returns ErrDuplicateKey if a record with the same
+// ID exists.
+func (s *IdempotencyStore) Save(ctx context.Context,
+	record idempo.Record,
+) (err error) {
+	_, err = s.coll.InsertOne(s.sessionContext(ctx), newDocument(record))
+	if err != nil {
+		err = mapInsertError(err)
+	}
+	return
+}
+
+// Update replaces an existing record.
+func (s *IdempotencyStore) Update(ctx context.Context,
+	record idempo.Record,
+) (err error) {
+	result, err := s.coll.ReplaceOne(s.sessionContext(ctx),
+		bson.D{{Key: "_id", Value: record.ID}}, newDocument(record))
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"mongo update error: %w", err)
+		return
+	}
+	if result.MatchedCount == 0 {
+		err = idempo.ErrIdempotencyRecordNotFound
+	}
+	return
+}
+
+// Delete removes a record.
+func (s *IdempotencyStore) Delete(ctx context.Context, id string) (err error) {
+	_, err = s.coll.DeleteOne(s.sessionContext(ctx),
+		bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"mongo delete error: %w", err)
+	}
+	return
+}
+
+// UpdateFenced replaces the in-progress record if it is held under the claim.
+func (s *IdempotencyStore) UpdateFenced(ctx context.Context, claim idempo.Claim,
+	record idempo.Record,
+) (err error) {
+	result, err := s.coll.ReplaceOne(s.sessionContext(ctx),
+		claimFilter(claim, record.ID), newDocument(record))
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"mongo update error: %w", err)
+		return
+	}
+	if result.MatchedCount == 0 {
+		err = idempo.ErrLeaseLost
+	}
+	return
+}
+
+// DeleteFenced removes the in-progress record if it is held under the claim.
+func (s *IdempotencyStore) DeleteFenced(ctx context.Context, claim idempo.Claim,
+	id string,
+) (err error) {
+	result, err := s.coll.DeleteOne(s.sessionContext(ctx), claimFilter(claim, id))
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"mongo delete error: %w", err)
+		return
+	}
+	if result.DeletedCount == 0 {
+		err = idempo.ErrLeaseLost
+	}
+	return
+}
+
+// List returns all records of the given scope.
+func (s *IdempotencyStore) List(ctx context.Context, scope string) (
+	records []idempo.Record, err error,
+) {
+	return s.find(ctx, bson.D{{Key: "scope", Value: scope}})
+}
+
+// Purge deletes all records of the given scope.
+func (s *IdempotencyStore) Purge(ctx context.Context, scope string) (err error) {
+	_, err = s.coll.DeleteMany(s.sessionContext(ctx),
+		bson.D{{Key: "scope", Value: scope}})
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"mongo purge error: %w", err)
+	}
+	return
+}
+
+// GetMany retrieves records by keys.
+func (s *IdempotencyStore) GetMany(ctx context.Context, ids []string) (
+	records map[string]idempo.Record, err error,
+) {
+	list, err := s.find(ctx,
+		bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+	if err != nil {
+		return
+	}
+	records = make(map[string]idempo.Record, len(list))
+	for _, record := range list {
+		records[record.ID] = record
+	}
+	return
+}
+
+// SaveMany creates new records.
+func (s *IdempotencyStore) SaveMany(ctx context.Context,
+	records []idempo.Record,
+) (err error) {
+	if len(records) == 0 {
+		return
+	}
+	docs := make([]document, len(records))
+	for i, record := range records {
+		docs[i] = newDocument(record)
+	}
+	if _, err = s.coll.InsertMany(s.sessionContext(ctx), docs); err != nil {
+		err = mapInsertError(err)
+	}
+	return
+}
+
+func (s *IdempotencyStore) find(ctx context.Context, filter bson.D) (
+	records []idempo.Record, err error,
+) {
+	ctx = s.sessionContext(ctx)
+	cursor, err := s.coll.Find(ctx, filter)
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"mongo find error: %w", err)
+		return
+	}
+	var docs []document
+	if err = cursor.All(ctx, &docs); err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"mongo find error: %w", err)
+		return
+	}
+	records = make([]idempo.Record, len(docs))
+	for i, doc := range docs {
+		records[i] = doc.record()
+	}
+	return
+}
+
+// claimFilter matches the in-progress record held under the claim.
+func claimFilter(claim idempo.Claim, id string) bson.D {
+	// Empty owners are omitted from documents, and null matches missing
+	// fields.
+	var owner any = claim.Owner
+	if claim.Owner == "" {
+		owner = nil
+	}
+	return bson.D{
+		{Key: "_id", Value: id},
+		{Key: "inProgress", Value: true},
+		{Key: "leaseOwner", Value: owner},
+		{Key: "fencingToken", Value: int64(claim.FencingToken)},
+	}
+}
+
+// sessionContext binds the session of the transaction to ctx, so the
+// operation is executed within the transaction and can be cancelled with ctx.
+func (s *IdempotencyStore) sessionContext(ctx context.Context) context.Context {
+	if s.session == nil {
+		return ctx
+	}
+	return mongo.NewSessionContext(ctx, s.session)
+}
+
+// document is the representation of the idempo.Record in the collection.
+type document struct {
+	ID            string `bson:"_id"`
+	InputHash     string `bson:"inputHash"`
+	SuccessOutput bool   `bson:"successOutput"`
+	Output        []byte `bson:"output"`
+	SchemaVersion int    `bson:"schemaVersion"`
+	Scope         string `bson:"scope,omitempty"`
+	// ExpiresAt is omitted for records that never expire, so the TTL index
+	// ignores them.
+	ExpiresAt      *time.Time `bson:"expiresAt,omitempty"`
+	InProgress     bool       `bson:"inProgress,omitempty"`
+	LeaseOwner     string     `bson:"leaseOwner,omitempty"`
+	LeaseExpiresAt *time.Time `bson:"leaseExpiresAt,omitempty"`
+	FencingToken   int64      `bson:"fencingToken,omitempty"`
+}
+
+func newDocument(record idempo.Record) document {
+	return document{
+		ID:             record.ID,
+		InputHash:      record.InputHash,
+		SuccessOutput:  record.SuccessOutput,
+		Output:         record.Output,
+		SchemaVersion:  record.SchemaVersion,
+		Scope:          record.Scope,
+		ExpiresAt:      timePtr(record.ExpiresAt),
+		InProgress:     record.InProgress,
+		LeaseOwner:     record.LeaseOwner,
+		LeaseExpiresAt: timePtr(record.LeaseExpiresAt),
+		FencingToken:   int64(record.FencingToken),
+	}
+}
+
+func (d document) record() idempo.Record {
+	return idempo.Record{
+		ID:             d.ID,
+		InputHash:      d.InputHash,
+		SuccessOutput:  d.SuccessOutput,
+		Output:         d.Output,
+		SchemaVersion:  d.SchemaVersion,
+		Scope:          d.Scope,
+		ExpiresAt:      timeValue(d.ExpiresAt),
+		InProgress:     d.InProgress,
+		LeaseOwner:     d.LeaseOwner,
+		LeaseExpiresAt: timeValue(d.LeaseExpiresAt),
+		FencingToken:   uint64(d.FencingToken),
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func timeValue(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
@@ -0,0 +1,58 @@
+package mongo
+
+import (
+	"context"
+
+	"github.com/ymz-ncnk/idempo-go"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// NewUnitOfWork is the constructor for the UnitOfWork.
+func NewUnitOfWork[T idempo.UOWRepos](client *mongo.Client,
+	factory RepositoryBundleFactory[T],
+) *UnitOfWork[T] {
+	return &UnitOfWork[T]{
+		client:  client,
+		factory: factory,
+	}
+}
+
+// UnitOfWork manages the transaction lifecycle for MongoDB. It runs the work
+// function within a multi-document transaction, which requires a replica set
+// or a sharded cluster.
+// It is generic over the Repository Bundle type (T).
+type UnitOfWork[T idempo.UOWRepos] struct {
+	client *mongo.Client
+	// factory is the external function used to construct the bundle (T)
+	// for a specific transaction (sessCtx).
+	factory RepositoryBundleFactory[T]
+}
+
+// Execute starts a transaction, executes the work function, and handles
+// commit/rollback.
+func (u *UnitOfWork[T]) Execute(fn func(repos T) error) error {
+	return u.ExecuteContext(context.Background(),
+		func(ctx context.Context, repos T) error {
+			return fn(repos)
+		})
+}
+
+// ExecuteContext is like Execute, but runs the transaction with the given
+// context and passes the session context to the work function.
+//
+// The transaction is run with session.WithTransaction, so the work function
+// can be called again if the transaction fails with a transient error.
+func (u *UnitOfWork[T]) ExecuteContext(ctx context.Context,
+	fn func(ctx context.Context, repos T) error,
+) (err error) {
+	session, err := u.client.StartSession()
+	if err != nil {
+		return
+	}
+	// The session must be ended even if ctx is done.
+	defer session.EndSession(context.WithoutCancel(ctx))
+	_, err = session.WithTransaction(ctx, func(sessCtx context.Context) (any, error) {
+		return nil, fn(sessCtx, u.factory(sessCtx))
+	})
+	return
+}
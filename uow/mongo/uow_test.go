@@ -0,0 +1,131 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+	serializer "github.com/ymz-ncnk/idempo-go/serializer/json"
+	"github.com/ymz-ncnk/idempo-go/uow/uowtest"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// TestUnitOfWork runs against the MongoDB replica set specified by the
+// IDEMPO_MONGO_URI environment variable, e.g. the one started with
+// "docker compose up -d mongo".
+func TestUnitOfWork(t *testing.T) {
+	uri := os.Getenv("IDEMPO_MONGO_URI")
+	if uri == "" {
+		t.Skip("IDEMPO_MONGO_URI is not set, run \"docker compose up -d mongo\" " +
+			"and set IDEMPO_MONGO_URI=" +
+			"mongodb://localhost:27017/?replicaSet=rs0&directConnection=true")
+	}
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	assertfatal.EqualError(err, nil, t)
+	defer client.Disconnect(context.Background())
+
+	var (
+		ctx     = context.Background()
+		db      = client.Database("idempo_test")
+		records = db.Collection(MongoIdempotencyCollectionName)
+		orders  = db.Collection("orders")
+	)
+	assertfatal.EqualError(db.Drop(ctx), nil, t)
+	// Collections can't be created implicitly within a transaction.
+	assertfatal.EqualError(db.CreateCollection(ctx, records.Name()), nil, t)
+	assertfatal.EqualError(db.CreateCollection(ctx, orders.Name()), nil, t)
+	assertfatal.EqualError(EnsureIndexes(ctx, records), nil, t)
+
+	var (
+		errFailed  = errors.New("failed")
+		unitOfWork = NewUnitOfWork(client, func(sessCtx context.Context) repos {
+			return repos{NewIdempotencyStore(sessCtx, records), orders, sessCtx}
+		})
+		wrapper = idempo.NewWrapper[repos, input](idempo.Config[repos, string, string]{
+			UnitOfWork: unitOfWork,
+			SuccessSer: serializer.JSONSerializer[string]{},
+			FailureSer: serializer.JSONSerializer[string]{},
+			ErrorToFailure: func(err error) (idempo.Persistence, string) {
+				return idempo.PersistNone, ""
+			},
+		})
+		calls  int
+		action = func(ctx context.Context, repos repos, idempotencyKey string,
+			in input,
+		) (orderID string, err error) {
+			calls++
+			_, err = repos.orders.InsertOne(repos.sessCtx,
+				bson.D{{Key: "_id", Value: idempotencyKey}})
+			if err != nil || in == "fail" {
+				return "", errors.Join(err, errFailed)
+			}
+			return idempotencyKey, nil
+		}
+	)
+
+	t.Run("Should replay the committed outcome", func(t *testing.T) {
+		orderID, err := wrapper.Wrap(ctx, "order-1", "ok", action)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(orderID, "order-1", t)
+
+		orderID, err = wrapper.Wrap(ctx, "order-1", "ok", action)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(orderID, "order-1", t)
+		assertfatal.Equal(calls, 1, t)
+
+		_, err = wrapper.Wrap(ctx, "order-1", "other", action)
+		assertfatal.EqualError(err, idempo.ErrHashMismatch, t)
+	})
+
+	t.Run("Should roll back the Action with its record", func(t *testing.T) {
+		_, err := wrapper.Wrap(ctx, "order-2", "fail", action)
+		assertfatal.Equal(errors.Is(err, errFailed), true, t)
+
+		n, err := orders.CountDocuments(ctx, bson.D{{Key: "_id", Value: "order-2"}})
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(n, int64(0), t)
+		n, err = records.CountDocuments(ctx, bson.D{{Key: "_id", Value: "order-2"}})
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(n, int64(0), t)
+	})
+
+	uowtest.TestStore(t, unitOfWork)
+}
+
+func TestRetryClassifier(t *testing.T) {
+	duplicateKey := mongo.WriteException{
+		WriteErrors: []mongo.WriteError{{Code: 11000}},
+	}
+
+	t.Run("Should retry duplicate records", func(t *testing.T) {
+		assertfatal.Equal(RetryClassifier.Retryable(mapInsertError(duplicateKey)),
+			true, t)
+	})
+
+	t.Run("Should not retry duplicate keys of the Action", func(t *testing.T) {
+		err := fmt.Errorf("insert order: %w", duplicateKey)
+		assertfatal.Equal(RetryClassifier.Retryable(err), false, t)
+	})
+}
+
+type repos struct {
+	store   idempo.Store
+	orders  *mongo.Collection
+	sessCtx context.Context
+}
+
+func (r repos) IdempotencyStore() idempo.Store {
+	return r.store
+}
+
+type input string
+
+func (in input) Hash() (string, error) {
+	return string(in), nil
+}
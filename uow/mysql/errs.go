@@ -0,0 +1,51 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+const (
+	// erDupEntry is the MySQL error number of duplicate key violations.
+	erDupEntry = 1062
+	// erLockWaitTimeout is the MySQL error number of lock wait timeouts.
+	erLockWaitTimeout = 1205
+	// erLockDeadlock is the MySQL error number of detected deadlocks.
+	erLockDeadlock = 1213
+)
+
+// ErrDuplicateKey is returned by the IdempotencyStore when a record with the
+// same ID has already been saved, e.g. by a concurrent transaction.
+var ErrDuplicateKey = errors.New(idempo.ErrorPrefix + "mysql duplicate key")
+
+// RetryClassifier is an idempo.RetryClassifier that classifies duplicate
+// keys, deadlocks and lock wait timeouts as retryable.
+//
+// With it, the loser of a race for the same idempotency key is retried and
+// receives the winner's outcome as a replay.
+var RetryClassifier = idempo.RetryClassifierFunc(func(err error) bool {
+	if errors.Is(err, ErrDuplicateKey) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	switch mysqlErr.Number {
+	case erDupEntry, erLockWaitTimeout, erLockDeadlock:
+		return true
+	}
+	return false
+})
+
+// mapError maps duplicate key violations to ErrDuplicateKey.
+func mapError(err error, op string) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == erDupEntry {
+		return fmt.Errorf("%w: %w", ErrDuplicateKey, err)
+	}
+	return fmt.Errorf(idempo.ErrorPrefix+"mysql %s error: %w", op, err)
+}
@@ -0,0 +1,284 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+const columns = `id, input_hash, success_output, output, schema_version, scope,
+	expires_at, in_progress, lease_owner, lease_expires_at, fencing_token`
+
+// NewIdempotencyStore returns a new MySQL idempotency store.
+//
+// DATETIME columns are scanned into time.Time, so the DSN must contain the
+// parseTime=true parameter.
+func NewIdempotencyStore(tx *sql.Tx) idempo.Store {
+	return &IdempotencyStore{tx}
+}
+
+// IdempotencyStore implements the app.IdempotencyStore interface.
+//
+// Save fails with ErrDuplicateKey if a concurrent transaction has saved a
+// record with the same ID, so the whole transaction, including the Action,
+// is rolled back.
+type IdempotencyStore struct {
+	tx *sql.Tx
+}
+
+// Get retrieves an IdempotencyRecord by key.
+func (s *IdempotencyStore) Get(ctx context.Context, id string) (
+	record idempo.Record, err error,
+) {
+	row := s.tx.QueryRowContext(ctx, `SELECT `+columns+` FROM `+
+		MySQLIdempotencyTableName+` WHERE id = ?`, id)
+	record, err = scanRecord(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = idempo.ErrIdempotencyRecordNotFound
+		return
+	}
+	if err != nil {
+		err = mapError(err, "get")
+	}
+	return
+}
+
+// Save creates a new record.
+func (s *IdempotencyStore) Save(ctx context.Context,
+	record idempo.Record,
+) (err error) {
+	return s.SaveMany(ctx, []idempo.Record{record})
+}
+
+// Update replaces an existing record.
+func (s *IdempotencyStore) Update(ctx context.Context,
+	record idempo.Record,
+) (err error) {
+	// MySQL reports only changed rows as affected, so existence is checked
+	// separately.
+	if _, err = s.Get(ctx, record.ID); err != nil {
+		return
+	}
+	_, err = s.tx.ExecContext(ctx, `UPDATE `+MySQLIdempotencyTableName+` SET
+		input_hash = ?, success_output = ?, output = ?, schema_version = ?,
+		scope = ?, expires_at = ?, in_progress = ?, lease_owner = ?,
+		lease_expires_at = ?, fencing_token = ?
+		WHERE id = ?`, append(args(record)[1:], record.ID)...)
+	if err != nil {
+		err = mapError(err, "update")
+	}
+	return
+}
+
+// Delete removes a record.
+func (s *IdempotencyStore) Delete(ctx context.Context, id string) (err error) {
+	_, err = s.tx.ExecContext(ctx, `DELETE FROM `+MySQLIdempotencyTableName+
+		` WHERE id = ?`, id)
+	if err != nil {
+		err = mapError(err, "delete")
+	}
+	return
+}
+
+// UpdateFenced replaces the in-progress record if it is held under the claim.
+func (s *IdempotencyStore) UpdateFenced(ctx context.Context, claim idempo.Claim,
+	record idempo.Record,
+) (err error) {
+	result, err := s.tx.ExecContext(ctx, `UPDATE `+MySQLIdempotencyTableName+` SET
+		input_hash = ?, success_output = ?, output = ?, schema_version = ?,
+		scope = ?, expires_at = ?, in_progress = ?, lease_owner = ?,
+		lease_expires_at = ?, fencing_token = ?
+		WHERE `+claimCondition, append(append(args(record)[1:], record.ID),
+		claimArgs(claim)...)...)
+	if err != nil {
+		return mapError(err, "update")
+	}
+	return s.checkFenced(ctx, result, claim, record.ID)
+}
+
+// DeleteFenced removes the in-progress record if it is held under the claim.
+func (s *IdempotencyStore) DeleteFenced(ctx context.Context, claim idempo.Claim,
+	id string,
+) (err error) {
+	result, err := s.tx.ExecContext(ctx, `DELETE FROM `+
+		MySQLIdempotencyTableName+` WHERE `+claimCondition,
+		append([]any{id}, claimArgs(claim)...)...)
+	if err != nil {
+		return mapError(err, "delete")
+	}
+	return s.checkFenced(ctx, result, claim, id)
+}
+
+// checkFenced returns idempo.ErrLeaseLost if the fenced write has not matched
+// the record. MySQL reports only changed rows as affected, so if there are
+// none, the match is checked with a locking read, which, unlike a plain one,
+// sees the latest committed record.
+func (s *IdempotencyStore) checkFenced(ctx context.Context, result sql.Result,
+	claim idempo.Claim,
+	id string,
+) (err error) {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return mapError(err, "rows affected")
+	}
+	if n > 0 {
+		return
+	}
+	var count int
+	err = s.tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+
+		MySQLIdempotencyTableName+` WHERE `+claimCondition+` FOR UPDATE`,
+		append([]any{id}, claimArgs(claim)...)...).Scan(&count)
+	if err != nil {
+		return mapError(err, "get")
+	}
+	if count == 0 {
+		err = idempo.ErrLeaseLost
+	}
+	return
+}
+
+// List returns all records of the given scope.
+func (s *IdempotencyStore) List(ctx context.Context, scope string) (
+	records []idempo.Record, err error,
+) {
+	return s.query(ctx, `SELECT `+columns+` FROM `+MySQLIdempotencyTableName+
+		` WHERE scope = ?`, scope)
+}
+
+// Purge deletes all records of the given scope.
+func (s *IdempotencyStore) Purge(ctx context.Context, scope string) (err error) {
+	_, err = s.tx.ExecContext(ctx, `DELETE FROM `+MySQLIdempotencyTableName+
+		` WHERE scope = ?`, scope)
+	if err != nil {
+		err = mapError(err, "purge")
+	}
+	return
+}
+
+// GetMany retrieves records by keys.
+func (s *IdempotencyStore) GetMany(ctx context.Context, ids []string) (
+	records map[string]idempo.Record, err error,
+) {
+	records = make(map[string]idempo.Record, len(ids))
+	if len(ids) == 0 {
+		return
+	}
+	params := make([]any, len(ids))
+	for i, id := range ids {
+		params[i] = id
+	}
+	list, err := s.query(ctx, `SELECT `+columns+` FROM `+
+		MySQLIdempotencyTableName+` WHERE id IN (`+placeholders(len(ids))+`)`,
+		params...)
+	if err != nil {
+		return
+	}
+	for _, record := range list {
+		records[record.ID] = record
+	}
+	return
+}
+
+// SaveMany creates new records.
+func (s *IdempotencyStore) SaveMany(ctx context.Context,
+	records []idempo.Record,
+) (err error) {
+	if len(records) == 0 {
+		return
+	}
+	var (
+		values = make([]string, len(records))
+		params = make([]any, 0, len(records)*11)
+	)
+	for i, record := range records {
+		values[i] = "(" + placeholders(11) + ")"
+		params = append(params, args(record)...)
+	}
+	_, err = s.tx.ExecContext(ctx, `INSERT INTO `+MySQLIdempotencyTableName+
+		` (`+columns+`) VALUES `+strings.Join(values, ", "), params...)
+	if err != nil {
+		err = mapError(err, "insert")
+	}
+	return
+}
+
+func (s *IdempotencyStore) query(ctx context.Context, query string,
+	params ...any,
+) (records []idempo.Record, err error) {
+	rows, err := s.tx.QueryContext(ctx, query, params...)
+	if err != nil {
+		err = mapError(err, "query")
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var record idempo.Record
+		if record, err = scanRecord(rows); err != nil {
+			err = mapError(err, "query")
+			return
+		}
+		records = append(records, record)
+	}
+	if err = rows.Err(); err != nil {
+		err = mapError(err, "query")
+	}
+	return
+}
+
+// claimCondition matches the in-progress record held under the claim.
+const claimCondition = `id = ? AND in_progress AND lease_owner = ? AND
+	fencing_token = ?`
+
+// claimArgs returns the values of claimCondition after the record ID.
+func claimArgs(claim idempo.Claim) []any {
+	return []any{claim.Owner, claim.FencingToken}
+}
+
+// args returns the column values of the record in the order of the columns.
+func args(record idempo.Record) []any {
+	return []any{
+		record.ID,
+		record.InputHash,
+		record.SuccessOutput,
+		nonNil(record.Output),
+		record.SchemaVersion,
+		record.Scope,
+		nullTime(record.ExpiresAt),
+		record.InProgress,
+		record.LeaseOwner,
+		nullTime(record.LeaseExpiresAt),
+		record.FencingToken,
+	}
+}
+
+func scanRecord(row interface{ Scan(dest ...any) error }) (
+	record idempo.Record, err error,
+) {
+	var expiresAt, leaseExpiresAt sql.NullTime
+	err = row.Scan(&record.ID, &record.InputHash, &record.SuccessOutput,
+		&record.Output, &record.SchemaVersion, &record.Scope, &expiresAt,
+		&record.InProgress, &record.LeaseOwner, &leaseExpiresAt,
+		&record.FencingToken)
+	record.ExpiresAt = expiresAt.Time
+	record.LeaseExpiresAt = leaseExpiresAt.Time
+	return
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func nonNil(bs []byte) []byte {
+	if bs == nil {
+		return []byte{}
+	}
+	return bs
+}
@@ -0,0 +1,141 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+
+	sqle "github.com/dolthub/go-mysql-server"
+	"github.com/dolthub/go-mysql-server/memory"
+	"github.com/dolthub/go-mysql-server/server"
+	gmssql "github.com/dolthub/go-mysql-server/sql"
+	_ "github.com/go-sql-driver/mysql"
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+	serializer "github.com/ymz-ncnk/idempo-go/serializer/json"
+	uow "github.com/ymz-ncnk/idempo-go/uow/sql"
+	"github.com/ymz-ncnk/idempo-go/uow/uowtest"
+)
+
+// TestIdempotencyStore runs against the MySQL server specified by the
+// IDEMPO_MYSQL_DSN environment variable, e.g.
+// "root:root@tcp(localhost:3306)/test?parseTime=true" for the one started
+// with "docker compose up -d mysql", or against an in-memory MySQL-compatible
+// server if it is not set.
+func TestIdempotencyStore(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = openDB(t)
+	)
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS "+MySQLIdempotencyTableName)
+	assertfatal.EqualError(err, nil, t)
+	_, err = db.ExecContext(ctx, Schema)
+	assertfatal.EqualError(err, nil, t)
+
+	var (
+		errFailed  = errors.New("failed")
+		unitOfWork = uow.NewUnitOfWork(db, func(tx *sql.Tx) repos {
+			return repos{NewIdempotencyStore(tx)}
+		}, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+		wrapper = idempo.NewWrapper[repos, input](idempo.Config[repos, string, string]{
+			UnitOfWork: unitOfWork,
+			SuccessSer: serializer.JSONSerializer[string]{},
+			FailureSer: serializer.JSONSerializer[string]{},
+			ErrorToFailure: func(err error) (idempo.Persistence, string) {
+				return idempo.PersistNone, ""
+			},
+			RetryPolicy: idempo.RetryPolicy{Classifier: RetryClassifier},
+		})
+		calls  int
+		action = func(ctx context.Context, repos repos, idempotencyKey string,
+			in input,
+		) (orderID string, err error) {
+			calls++
+			if in == "fail" {
+				return "", errFailed
+			}
+			return idempotencyKey, nil
+		}
+	)
+
+	t.Run("Should replay the committed outcome", func(t *testing.T) {
+		orderID, err := wrapper.Wrap(ctx, "order-1", "ok", action)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(orderID, "order-1", t)
+
+		orderID, err = wrapper.Wrap(ctx, "order-1", "ok", action)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(orderID, "order-1", t)
+		assertfatal.Equal(calls, 1, t)
+
+		_, err = wrapper.Wrap(ctx, "order-1", "other", action)
+		assertfatal.EqualError(err, idempo.ErrHashMismatch, t)
+	})
+
+	t.Run("Should roll back the record if the Action fails", func(t *testing.T) {
+		_, err := wrapper.Wrap(ctx, "order-2", "fail", action)
+		assertfatal.EqualError(err, errFailed, t)
+		err = unitOfWork.Execute(func(repos repos) error {
+			_, err := repos.store.Get(ctx, "order-2")
+			return err
+		})
+		assertfatal.EqualError(err, idempo.ErrIdempotencyRecordNotFound, t)
+	})
+
+	t.Run("Should map duplicate keys to ErrDuplicateKey", func(t *testing.T) {
+		err := unitOfWork.Execute(func(repos repos) error {
+			return repos.store.Save(ctx, idempo.Record{ID: "order-1"})
+		})
+		assertfatal.Equal(errors.Is(err, ErrDuplicateKey), true, t)
+		assertfatal.Equal(RetryClassifier.Retryable(err), true, t)
+	})
+
+	uowtest.TestStore(t, unitOfWork)
+}
+
+func openDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("IDEMPO_MYSQL_DSN")
+	if dsn == "" {
+		dsn = startServer(t)
+	}
+	db, err := sql.Open("mysql", dsn)
+	assertfatal.EqualError(err, nil, t)
+	return db
+}
+
+// startServer starts an in-memory MySQL-compatible server and returns its DSN.
+func startServer(t *testing.T) (dsn string) {
+	var (
+		pro    = memory.NewDBProvider(memory.NewDatabase("test"))
+		engine = sqle.NewDefault(pro)
+	)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assertfatal.EqualError(err, nil, t)
+	addr := listener.Addr().String()
+	listener.Close()
+	s, err := server.NewServer(server.Config{Protocol: "tcp", Address: addr},
+		engine, gmssql.NewContext, memory.NewSessionBuilder(pro), nil)
+	assertfatal.EqualError(err, nil, t)
+	go s.Start()
+	t.Cleanup(func() { s.Close() })
+	return fmt.Sprintf("root@tcp(%s)/test?parseTime=true", addr)
+}
+
+type repos struct {
+	store idempo.Store
+}
+
+func (r repos) IdempotencyStore() idempo.Store {
+	return r.store
+}
+
+type input string
+
+func (in input) Hash() (string, error) {
+	return string(in), nil
+}
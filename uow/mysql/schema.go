@@ -0,0 +1,26 @@
+package mysql
+
+// MySQLIdempotencyTableName is the table name for idempotency records.
+const MySQLIdempotencyTableName = "idempotency_records"
+
+// Schema is the migration DDL of the idempotency records table.
+//
+// Outputs are stored in VARBINARY columns limited to 16 KiB, so that the
+// row fits the 64 KiB limit of MySQL. Larger outputs require a MEDIUMBLOB
+// column, or the compress.Serializer.
+const Schema = `CREATE TABLE IF NOT EXISTS ` + MySQLIdempotencyTableName + ` (
+	id               VARBINARY(512)   NOT NULL,
+	input_hash       VARBINARY(255)   NOT NULL,
+	success_output   BOOLEAN          NOT NULL,
+	output           VARBINARY(16384) NOT NULL,
+	schema_version   INT              NOT NULL DEFAULT 0,
+	scope            VARBINARY(512)   NOT NULL DEFAULT '',
+	expires_at       DATETIME(6)      NULL,
+	in_progress      BOOLEAN          NOT NULL DEFAULT FALSE,
+	lease_owner      VARBINARY(255)   NOT NULL DEFAULT '',
+	lease_expires_at DATETIME(6)      NULL,
+	fencing_token    BIGINT UNSIGNED  NOT NULL DEFAULT 0,
+	PRIMARY KEY (id),
+	KEY idx_scope (scope),
+	KEY idx_expires_at (expires_at)
+)`
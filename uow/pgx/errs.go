@@ -0,0 +1,14 @@
+package pgx
+
+import "github.com/ymz-ncnk/idempo-go"
+
+// uniqueViolation is the SQLSTATE code of unique constraint violations.
+const uniqueViolation = "23505"
+
+// RetryClassifier is an idempo.RetryClassifier that classifies unique
+// violations, serialization failures and detected deadlocks as retryable.
+//
+// With it, the loser of a race for the same idempotency key is retried and
+// receives the winner's outcome as a replay.
+var RetryClassifier = append(idempo.SQLStateClassifier{uniqueViolation},
+	idempo.PostgresClassifier...)
@@ -0,0 +1,11 @@
+package pgx
+
+import (
+	"github.com/jackc/pgx/v5"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// RepositoryBundleFactory is a function that accepts a transaction (tx) and
+// constructs the full application and idempotency repository bundle (T) for
+// that specific transaction.
+type RepositoryBundleFactory[T idempo.UOWRepos] func(tx pgx.Tx) T
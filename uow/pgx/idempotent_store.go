@@ -0,0 +1,229 @@
+package pgx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+const columns = `id, input_hash, success_output, output, schema_version, scope,
+	expires_at, in_progress, lease_owner, lease_expires_at, fencing_token`
+
+// NewIdempotencyStore returns a new pgx idempotency store.
+func NewIdempotencyStore(tx pgx.Tx) idempo.Store {
+	return &IdempotencyStore{tx}
+}
+
+// IdempotencyStore implements the app.IdempotencyStore interface.
+//
+// It requires the table created by Schema.
+type IdempotencyStore struct {
+	tx pgx.Tx
+}
+
+// Get retrieves an IdempotencyRecord by key.
+func (s *IdempotencyStore) Get(ctx context.Context, id string) (
+	record idempo.Record, err error,
+) {
+	record, err = scan(s.tx.QueryRow(ctx, `SELECT `+columns+` FROM `+
+		PgxIdempotencyTableName+` WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = idempo.ErrIdempotencyRecordNotFound
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"pgx get error: %w", err)
+	}
+	return
+}
+
+// Save creates a new record.
+func (s *IdempotencyStore) Save(ctx context.Context,
+	record idempo.Record,
+) (err error) {
+	_, err = s.tx.Exec(ctx, insertQuery, args(record)...)
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"pgx insert error: %w", err)
+	}
+	return
+}
+
+// Update replaces an existing record.
+func (s *IdempotencyStore) Update(ctx context.Context,
+	record idempo.Record,
+) (err error) {
+	tag, err := s.tx.Exec(ctx, `UPDATE `+PgxIdempotencyTableName+` SET
+		input_hash = $2, success_output = $3, output = $4, schema_version = $5,
+		scope = $6, expires_at = $7, in_progress = $8, lease_owner = $9,
+		lease_expires_at = $10, fencing_token = $11
+		WHERE id = $1`, args(record)...)
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"pgx update error: %w", err)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		err = idempo.ErrIdempotencyRecordNotFound
+	}
+	return
+}
+
+// Delete removes a record.
+func (s *IdempotencyStore) Delete(ctx context.Context, id string) (err error) {
+	_, err = s.tx.Exec(ctx, `DELETE FROM `+PgxIdempotencyTableName+
+		` WHERE id = $1`, id)
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"pgx delete error: %w", err)
+	}
+	return
+}
+
+// UpdateFenced replaces the in-progress record if it is held under the claim.
+func (s *IdempotencyStore) UpdateFenced(ctx context.Context, claim idempo.Claim,
+	record idempo.Record,
+) (err error) {
+	tag, err := s.tx.Exec(ctx, `UPDATE `+PgxIdempotencyTableName+` SET
+		input_hash = $2, success_output = $3, output = $4, schema_version = $5,
+		scope = $6, expires_at = $7, in_progress = $8, lease_owner = $9,
+		lease_expires_at = $10, fencing_token = $11
+		WHERE id = $1 AND in_progress AND lease_owner = $12 AND
+		fencing_token = $13`, append(args(record), claim.Owner,
+		int64(claim.FencingToken))...)
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"pgx update error: %w", err)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		err = idempo.ErrLeaseLost
+	}
+	return
+}
+
+// DeleteFenced removes the in-progress record if it is held under the claim.
+func (s *IdempotencyStore) DeleteFenced(ctx context.Context, claim idempo.Claim,
+	id string,
+) (err error) {
+	tag, err := s.tx.Exec(ctx, `DELETE FROM `+PgxIdempotencyTableName+
+		` WHERE id = $1 AND in_progress AND lease_owner = $2 AND
+		fencing_token = $3`, id, claim.Owner, int64(claim.FencingToken))
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"pgx delete error: %w", err)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		err = idempo.ErrLeaseLost
+	}
+	return
+}
+
+// List returns all records of the given scope.
+func (s *IdempotencyStore) List(ctx context.Context, scope string) (
+	records []idempo.Record, err error,
+) {
+	return s.query(ctx, `SELECT `+columns+` FROM `+PgxIdempotencyTableName+
+		` WHERE scope = $1`, scope)
+}
+
+// Purge deletes all records of the given scope.
+func (s *IdempotencyStore) Purge(ctx context.Context, scope string) (err error) {
+	_, err = s.tx.Exec(ctx, `DELETE FROM `+PgxIdempotencyTableName+
+		` WHERE scope = $1`, scope)
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"pgx purge error: %w", err)
+	}
+	return
+}
+
+// GetMany retrieves records by keys.
+func (s *IdempotencyStore) GetMany(ctx context.Context, ids []string) (
+	records map[string]idempo.Record, err error,
+) {
+	records = make(map[string]idempo.Record, len(ids))
+	if len(ids) == 0 {
+		return
+	}
+	list, err := s.query(ctx, `SELECT `+columns+` FROM `+
+		PgxIdempotencyTableName+` WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return
+	}
+	for _, record := range list {
+		records[record.ID] = record
+	}
+	return
+}
+
+// SaveMany creates new records in a single round trip.
+func (s *IdempotencyStore) SaveMany(ctx context.Context,
+	records []idempo.Record,
+) (err error) {
+	if len(records) == 0 {
+		return
+	}
+	batch := &pgx.Batch{}
+	for _, record := range records {
+		batch.Queue(insertQuery, args(record)...)
+	}
+	if err = s.tx.SendBatch(ctx, batch).Close(); err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"pgx insert error: %w", err)
+	}
+	return
+}
+
+func (s *IdempotencyStore) query(ctx context.Context, query string,
+	args ...any,
+) (records []idempo.Record, err error) {
+	rows, err := s.tx.Query(ctx, query, args...)
+	if err == nil {
+		records, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (
+			idempo.Record, error,
+		) {
+			return scan(row)
+		})
+	}
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"pgx query error: %w", err)
+	}
+	return
+}
+
+const insertQuery = `INSERT INTO ` + PgxIdempotencyTableName + ` (` + columns +
+	`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+func args(record idempo.Record) []any {
+	return []any{record.ID, record.InputHash, record.SuccessOutput,
+		record.Output, record.SchemaVersion, record.Scope,
+		nullTime(record.ExpiresAt), record.InProgress, record.LeaseOwner,
+		nullTime(record.LeaseExpiresAt), int64(record.FencingToken)}
+}
+
+func scan(row pgx.Row) (record idempo.Record, err error) {
+	var (
+		expiresAt, leaseExpiresAt *time.Time
+		fencingToken              int64
+	)
+	err = row.Scan(&record.ID, &record.InputHash, &record.SuccessOutput,
+		&record.Output, &record.SchemaVersion, &record.Scope, &expiresAt,
+		&record.InProgress, &record.LeaseOwner, &leaseExpiresAt, &fencingToken)
+	if err != nil {
+		return
+	}
+	if expiresAt != nil {
+		record.ExpiresAt = *expiresAt
+	}
+	if leaseExpiresAt != nil {
+		record.LeaseExpiresAt = *leaseExpiresAt
+	}
+	record.FencingToken = uint64(fencingToken)
+	return
+}
+
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,21 @@
+package pgx
+
+// PgxIdempotencyTableName is the table name for idempotency records.
+const PgxIdempotencyTableName = "idempotency_records"
+
+// Schema is the migration DDL of the idempotency records table.
+const Schema = `CREATE TABLE IF NOT EXISTS ` + PgxIdempotencyTableName + ` (
+	id               TEXT        NOT NULL PRIMARY KEY,
+	input_hash       TEXT        NOT NULL,
+	success_output   BOOLEAN     NOT NULL,
+	output           BYTEA,
+	schema_version   INTEGER     NOT NULL DEFAULT 0,
+	scope            TEXT        NOT NULL DEFAULT '',
+	expires_at       TIMESTAMPTZ,
+	in_progress      BOOLEAN     NOT NULL DEFAULT FALSE,
+	lease_owner      TEXT        NOT NULL DEFAULT '',
+	lease_expires_at TIMESTAMPTZ,
+	fencing_token    BIGINT      NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_records_scope
+	ON ` + PgxIdempotencyTableName + ` (scope)`
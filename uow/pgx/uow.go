@@ -0,0 +1,77 @@
+package pgx
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// DB starts transactions, it is implemented by *pgxpool.Pool and *pgx.Conn.
+type DB interface {
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+// NewUnitOfWork is the constructor for the UnitOfWork. opts defines the
+// isolation level of transactions.
+func NewUnitOfWork[T idempo.UOWRepos](db DB, factory RepositoryBundleFactory[T],
+	opts pgx.TxOptions,
+) *UnitOfWork[T] {
+	return &UnitOfWork[T]{
+		db:      db,
+		factory: factory,
+		opts:    opts,
+	}
+}
+
+// UnitOfWork manages the transaction lifecycle for pgx.
+// It is generic over the Repository Bundle type (T).
+//
+// Executions can be nested: if the context passed to ExecuteContext belongs
+// to a transaction of the same DB, e.g. an Action calls another Wrapper, the
+// work function is executed within a SAVEPOINT of that transaction. If it
+// fails, only its own changes are rolled back and the outer transaction can
+// still be committed.
+type UnitOfWork[T idempo.UOWRepos] struct {
+	db DB
+	// factory is the external function used to construct the bundle (T)
+	// for a specific transaction (tx).
+	factory RepositoryBundleFactory[T]
+	opts    pgx.TxOptions
+}
+
+// Execute starts a transaction, executes the work function, and handles
+// commit/rollback.
+func (u *UnitOfWork[T]) Execute(fn func(repos T) error) error {
+	return u.ExecuteContext(context.Background(),
+		func(ctx context.Context, repos T) error {
+			return fn(repos)
+		})
+}
+
+// ExecuteContext is like Execute, but starts the transaction with the given
+// context. The work function receives a context that carries the
+// transaction, so nested executions run within savepoints.
+func (u *UnitOfWork[T]) ExecuteContext(ctx context.Context,
+	fn func(ctx context.Context, repos T) error,
+) (err error) {
+	var tx pgx.Tx
+	if outer, ok := ctx.Value(txKey{u.db}).(pgx.Tx); ok {
+		tx, err = outer.Begin(ctx)
+	} else {
+		tx, err = u.db.BeginTx(ctx, u.opts)
+	}
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+	if err = fn(context.WithValue(ctx, txKey{u.db}, tx), u.factory(tx)); err != nil {
+		return
+	}
+	return tx.Commit(ctx)
+}
+
+// txKey is the context key of the active transaction of the DB.
+type txKey struct {
+	db DB
+}
@@ -0,0 +1,11 @@
+package sqlx
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// RepositoryBundleFactory is a function that accepts a transaction (tx) and
+// constructs the full application and idempotency repository bundle (T) for
+// that specific transaction.
+type RepositoryBundleFactory[T idempo.UOWRepos] func(tx *sqlx.Tx) T
@@ -0,0 +1,274 @@
+package sqlx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+const columns = `id, input_hash, success_output, output, schema_version, scope,
+	expires_at, in_progress, lease_owner, lease_expires_at, fencing_token`
+
+// NewIdempotencyStore returns a new sqlx idempotency store.
+func NewIdempotencyStore(tx *sqlx.Tx) idempo.Store {
+	return &IdempotencyStore{tx}
+}
+
+// IdempotencyStore implements the app.IdempotencyStore interface.
+//
+// Queries are rebound to the placeholder format of the driver, so the Store
+// works with any database that has the table created by SQLiteSchema,
+// PostgresSchema or an equivalent DDL.
+type IdempotencyStore struct {
+	tx *sqlx.Tx
+}
+
+// Get retrieves an IdempotencyRecord by key.
+func (s *IdempotencyStore) Get(ctx context.Context, id string) (
+	record idempo.Record, err error,
+) {
+	var r row
+	err = s.tx.GetContext(ctx, &r, s.tx.Rebind(`SELECT `+columns+` FROM `+
+		SqlxIdempotencyTableName+` WHERE id = ?`), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = idempo.ErrIdempotencyRecordNotFound
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"sqlx get error: %w", err)
+		return
+	}
+	record = r.record()
+	return
+}
+
+// Save creates a new record.
+func (s *IdempotencyStore) Save(ctx context.Context,
+	record idempo.Record,
+) (err error) {
+	return s.SaveMany(ctx, []idempo.Record{record})
+}
+
+// Update replaces an existing record.
+func (s *IdempotencyStore) Update(ctx context.Context,
+	record idempo.Record,
+) (err error) {
+	// Some databases (e.g. MySQL) report only changed rows as affected, so
+	// existence is checked separately.
+	if _, err = s.Get(ctx, record.ID); err != nil {
+		return
+	}
+	_, err = s.tx.NamedExecContext(ctx, `UPDATE `+SqlxIdempotencyTableName+` SET
+		input_hash = :input_hash, success_output = :success_output,
+		output = :output, schema_version = :schema_version, scope = :scope,
+		expires_at = :expires_at, in_progress = :in_progress,
+		lease_owner = :lease_owner, lease_expires_at = :lease_expires_at,
+		fencing_token = :fencing_token
+		WHERE id = :id`, newRow(record))
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"sqlx update error: %w", err)
+	}
+	return
+}
+
+// Delete removes a record.
+func (s *IdempotencyStore) Delete(ctx context.Context, id string) (err error) {
+	_, err = s.tx.ExecContext(ctx, s.tx.Rebind(`DELETE FROM `+
+		SqlxIdempotencyTableName+` WHERE id = ?`), id)
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"sqlx delete error: %w", err)
+	}
+	return
+}
+
+// UpdateFenced replaces the in-progress record if it is held under the claim.
+//
+// Fenced writes always change the row (at least its in_progress or
+// lease_expires_at column), so no affected rows mean that the lease was lost,
+// even on databases that report only changed rows as affected.
+func (s *IdempotencyStore) UpdateFenced(ctx context.Context, claim idempo.Claim,
+	record idempo.Record,
+) (err error) {
+	result, err := s.tx.NamedExecContext(ctx, `UPDATE `+SqlxIdempotencyTableName+` SET
+		input_hash = :input_hash, success_output = :success_output,
+		output = :output, schema_version = :schema_version, scope = :scope,
+		expires_at = :expires_at, in_progress = :in_progress,
+		lease_owner = :lease_owner, lease_expires_at = :lease_expires_at,
+		fencing_token = :fencing_token
+		WHERE id = :id AND in_progress = :claim_in_progress AND
+		lease_owner = :claim_owner AND fencing_token = :claim_fencing_token`,
+		fencedRow{newRow(record), true, claim.Owner, int64(claim.FencingToken)})
+	if err != nil {
+		return fmt.Errorf(idempo.ErrorPrefix+"sqlx update error: %w", err)
+	}
+	return checkFenced(result)
+}
+
+// DeleteFenced removes the in-progress record if it is held under the claim.
+func (s *IdempotencyStore) DeleteFenced(ctx context.Context, claim idempo.Claim,
+	id string,
+) (err error) {
+	result, err := s.tx.ExecContext(ctx, s.tx.Rebind(`DELETE FROM `+
+		SqlxIdempotencyTableName+` WHERE id = ? AND in_progress = ? AND
+		lease_owner = ? AND fencing_token = ?`), id, true, claim.Owner,
+		int64(claim.FencingToken))
+	if err != nil {
+		return fmt.Errorf(idempo.ErrorPrefix+"sqlx delete error: %w", err)
+	}
+	return checkFenced(result)
+}
+
+// List returns all records of the given scope.
+func (s *IdempotencyStore) List(ctx context.Context, scope string) (
+	records []idempo.Record, err error,
+) {
+	return s.query(ctx, `SELECT `+columns+` FROM `+SqlxIdempotencyTableName+
+		` WHERE scope = ?`, scope)
+}
+
+// Purge deletes all records of the given scope.
+func (s *IdempotencyStore) Purge(ctx context.Context, scope string) (err error) {
+	_, err = s.tx.ExecContext(ctx, s.tx.Rebind(`DELETE FROM `+
+		SqlxIdempotencyTableName+` WHERE scope = ?`), scope)
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"sqlx purge error: %w", err)
+	}
+	return
+}
+
+// GetMany retrieves records by keys.
+func (s *IdempotencyStore) GetMany(ctx context.Context, ids []string) (
+	records map[string]idempo.Record, err error,
+) {
+	records = make(map[string]idempo.Record, len(ids))
+	if len(ids) == 0 {
+		return
+	}
+	query, args, err := sqlx.In(`SELECT `+columns+` FROM `+
+		SqlxIdempotencyTableName+` WHERE id IN (?)`, ids)
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"sqlx query error: %w", err)
+		return
+	}
+	list, err := s.query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	for _, record := range list {
+		records[record.ID] = record
+	}
+	return
+}
+
+// SaveMany creates new records.
+func (s *IdempotencyStore) SaveMany(ctx context.Context,
+	records []idempo.Record,
+) (err error) {
+	if len(records) == 0 {
+		return
+	}
+	rows := make([]row, len(records))
+	for i, record := range records {
+		rows[i] = newRow(record)
+	}
+	_, err = s.tx.NamedExecContext(ctx, `INSERT INTO `+SqlxIdempotencyTableName+
+		` (`+columns+`) VALUES (:id, :input_hash, :success_output, :output,
+		:schema_version, :scope, :expires_at, :in_progress, :lease_owner,
+		:lease_expires_at, :fencing_token)`, rows)
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"sqlx insert error: %w", err)
+	}
+	return
+}
+
+func (s *IdempotencyStore) query(ctx context.Context, query string,
+	args ...any,
+) (records []idempo.Record, err error) {
+	var rows []row
+	if err = s.tx.SelectContext(ctx, &rows, s.tx.Rebind(query), args...); err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"sqlx query error: %w", err)
+		return
+	}
+	records = make([]idempo.Record, len(rows))
+	for i, r := range rows {
+		records[i] = r.record()
+	}
+	return
+}
+
+// checkFenced returns idempo.ErrLeaseLost if the fenced write has not affected
+// any rows.
+func checkFenced(result sql.Result) (err error) {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf(idempo.ErrorPrefix+"sqlx rows affected error: %w", err)
+	}
+	if n == 0 {
+		err = idempo.ErrLeaseLost
+	}
+	return
+}
+
+// fencedRow is the row of the fenced update along with the claim.
+type fencedRow struct {
+	row
+	ClaimInProgress   bool   `db:"claim_in_progress"`
+	ClaimOwner        string `db:"claim_owner"`
+	ClaimFencingToken int64  `db:"claim_fencing_token"`
+}
+
+// row is the representation of the idempo.Record in the table.
+type row struct {
+	ID             string       `db:"id"`
+	InputHash      string       `db:"input_hash"`
+	SuccessOutput  bool         `db:"success_output"`
+	Output         []byte       `db:"output"`
+	SchemaVersion  int          `db:"schema_version"`
+	Scope          string       `db:"scope"`
+	ExpiresAt      sql.NullTime `db:"expires_at"`
+	InProgress     bool         `db:"in_progress"`
+	LeaseOwner     string       `db:"lease_owner"`
+	LeaseExpiresAt sql.NullTime `db:"lease_expires_at"`
+	FencingToken   int64        `db:"fencing_token"`
+}
+
+func newRow(record idempo.Record) row {
+	return row{
+		ID:             record.ID,
+		InputHash:      record.InputHash,
+		SuccessOutput:  record.SuccessOutput,
+		Output:         record.Output,
+		SchemaVersion:  record.SchemaVersion,
+		Scope:          record.Scope,
+		ExpiresAt:      nullTime(record.ExpiresAt),
+		InProgress:     record.InProgress,
+		LeaseOwner:     record.LeaseOwner,
+		LeaseExpiresAt: nullTime(record.LeaseExpiresAt),
+		FencingToken:   int64(record.FencingToken),
+	}
+}
+
+func (r row) record() idempo.Record {
+	return idempo.Record{
+		ID:             r.ID,
+		InputHash:      r.InputHash,
+		SuccessOutput:  r.SuccessOutput,
+		Output:         r.Output,
+		SchemaVersion:  r.SchemaVersion,
+		Scope:          r.Scope,
+		ExpiresAt:      r.ExpiresAt.Time,
+		InProgress:     r.InProgress,
+		LeaseOwner:     r.LeaseOwner,
+		LeaseExpiresAt: r.LeaseExpiresAt.Time,
+		FencingToken:   uint64(r.FencingToken),
+	}
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
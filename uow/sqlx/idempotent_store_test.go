@@ -0,0 +1,99 @@
+package sqlx
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+	serializer "github.com/ymz-ncnk/idempo-go/serializer/json"
+	"github.com/ymz-ncnk/idempo-go/uow/uowtest"
+	_ "modernc.org/sqlite"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	db, err := sqlx.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	assertfatal.EqualError(err, nil, t)
+	defer db.Close()
+	_, err = db.Exec(SQLiteSchema)
+	assertfatal.EqualError(err, nil, t)
+	_, err = db.Exec(`CREATE TABLE orders (id TEXT NOT NULL PRIMARY KEY)`)
+	assertfatal.EqualError(err, nil, t)
+
+	var (
+		ctx        = context.Background()
+		errFailed  = errors.New("failed")
+		unitOfWork = NewUnitOfWork(db, func(tx *sqlx.Tx) repos {
+			return repos{NewIdempotencyStore(tx), tx}
+		}, nil)
+		wrapper = idempo.NewWrapper[repos, input](idempo.Config[repos, string, string]{
+			UnitOfWork: unitOfWork,
+			SuccessSer: serializer.JSONSerializer[string]{},
+			FailureSer: serializer.JSONSerializer[string]{},
+			ErrorToFailure: func(err error) (idempo.Persistence, string) {
+				return idempo.PersistNone, ""
+			},
+		})
+		calls  int
+		action = func(ctx context.Context, repos repos, idempotencyKey string,
+			in input,
+		) (orderID string, err error) {
+			calls++
+			_, err = repos.tx.ExecContext(ctx, `INSERT INTO orders (id) VALUES (?)`,
+				idempotencyKey)
+			if err != nil {
+				return
+			}
+			if in == "fail" {
+				return "", errFailed
+			}
+			return idempotencyKey, nil
+		}
+		count = func(table, id string) (n int) {
+			err := db.Get(&n, `SELECT COUNT(*) FROM `+table+` WHERE id = ?`, id)
+			assertfatal.EqualError(err, nil, t)
+			return
+		}
+	)
+
+	t.Run("Should replay the committed outcome", func(t *testing.T) {
+		orderID, err := wrapper.Wrap(ctx, "order-1", "ok", action)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(orderID, "order-1", t)
+
+		orderID, err = wrapper.Wrap(ctx, "order-1", "ok", action)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(orderID, "order-1", t)
+		assertfatal.Equal(calls, 1, t)
+
+		_, err = wrapper.Wrap(ctx, "order-1", "other", action)
+		assertfatal.EqualError(err, idempo.ErrHashMismatch, t)
+	})
+
+	t.Run("Should roll back the Action with its record", func(t *testing.T) {
+		_, err := wrapper.Wrap(ctx, "order-2", "fail", action)
+		assertfatal.EqualError(err, errFailed, t)
+		assertfatal.Equal(count("orders", "order-2"), 0, t)
+		assertfatal.Equal(count(SqlxIdempotencyTableName, "order-2"), 0, t)
+	})
+
+	uowtest.TestStore(t, unitOfWork)
+}
+
+type repos struct {
+	store idempo.Store
+	tx    *sqlx.Tx
+}
+
+func (r repos) IdempotencyStore() idempo.Store {
+	return r.store
+}
+
+type input string
+
+func (in input) Hash() (string, error) {
+	return string(in), nil
+}
@@ -0,0 +1,40 @@
+package sqlx
+
+// SqlxIdempotencyTableName is the table name for idempotency records.
+const SqlxIdempotencyTableName = "idempotency_records"
+
+// SQLiteSchema is the migration DDL of the idempotency records table for
+// SQLite.
+const SQLiteSchema = `CREATE TABLE IF NOT EXISTS ` + SqlxIdempotencyTableName + ` (
+	id               TEXT     NOT NULL PRIMARY KEY,
+	input_hash       TEXT     NOT NULL,
+	success_output   BOOLEAN  NOT NULL,
+	output           BLOB,
+	schema_version   INTEGER  NOT NULL DEFAULT 0,
+	scope            TEXT     NOT NULL DEFAULT '',
+	expires_at       DATETIME,
+	in_progress      BOOLEAN  NOT NULL DEFAULT FALSE,
+	lease_owner      TEXT     NOT NULL DEFAULT '',
+	lease_expires_at DATETIME,
+	fencing_token    INTEGER  NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_records_scope
+	ON ` + SqlxIdempotencyTableName + ` (scope)`
+
+// PostgresSchema is the migration DDL of the idempotency records table for
+// PostgreSQL.
+const PostgresSchema = `CREATE TABLE IF NOT EXISTS ` + SqlxIdempotencyTableName + ` (
+	id               TEXT        NOT NULL PRIMARY KEY,
+	input_hash       TEXT        NOT NULL,
+	success_output   BOOLEAN     NOT NULL,
+	output           BYTEA,
+	schema_version   INTEGER     NOT NULL DEFAULT 0,
+	scope            TEXT        NOT NULL DEFAULT '',
+	expires_at       TIMESTAMPTZ,
+	in_progress      BOOLEAN     NOT NULL DEFAULT FALSE,
+	lease_owner      TEXT        NOT NULL DEFAULT '',
+	lease_expires_at TIMESTAMPTZ,
+	fencing_token    BIGINT      NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_records_scope
+	ON ` + SqlxIdempotencyTableName + ` (scope)`
@@ -0,0 +1,57 @@
+package sqlx
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// NewUnitOfWork is the constructor for the UnitOfWork. opts defines the
+// isolation level of transactions, nil means the default one of the driver.
+func NewUnitOfWork[T idempo.UOWRepos](db *sqlx.DB,
+	factory RepositoryBundleFactory[T],
+	opts *sql.TxOptions,
+) *UnitOfWork[T] {
+	return &UnitOfWork[T]{
+		db:      db,
+		factory: factory,
+		opts:    opts,
+	}
+}
+
+// UnitOfWork manages the transaction lifecycle for sqlx.
+// It is generic over the Repository Bundle type (T).
+type UnitOfWork[T idempo.UOWRepos] struct {
+	db *sqlx.DB
+	// factory is the external function used to construct the bundle (T)
+	// for a specific transaction (tx).
+	factory RepositoryBundleFactory[T]
+	opts    *sql.TxOptions
+}
+
+// Execute starts a transaction, executes the work function, and handles
+// commit/rollback.
+func (u *UnitOfWork[T]) Execute(fn func(repos T) error) error {
+	return u.ExecuteContext(context.Background(),
+		func(ctx context.Context, repos T) error {
+			return fn(repos)
+		})
+}
+
+// ExecuteContext is like Execute, but starts the transaction with the given
+// context.
+func (u *UnitOfWork[T]) ExecuteContext(ctx context.Context,
+	fn func(ctx context.Context, repos T) error,
+) (err error) {
+	tx, err := u.db.BeginTxx(ctx, u.opts)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	if err = fn(ctx, u.factory(tx)); err != nil {
+		return
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,392 @@
+package uowtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// TestStore checks that the idempo.Store of the UnitOfWork, and the optional
+// interfaces it implements (idempo.Updater, idempo.Deleter,
+// idempo.FencedStore, idempo.ScopedStore and idempo.BatchStore), conform to
+// their contracts.
+//
+// Each check runs in its own UnitOfWork and uses unique IDs and scopes, so the
+// Store doesn't have to be empty.
+func TestStore[T idempo.UOWRepos](t *testing.T, unitOfWork idempo.UnitOfWork[T]) {
+	var (
+		ctx    = context.Background()
+		prefix = uuid.NewString()
+		exec   = func(fn func(store idempo.Store) error) error {
+			return unitOfWork.Execute(func(repos T) error {
+				return fn(repos.IdempotencyStore())
+			})
+		}
+		get = func(id string) (record idempo.Record, err error) {
+			err = exec(func(store idempo.Store) (err error) {
+				record, err = store.Get(ctx, id)
+				return
+			})
+			return
+		}
+		save = func(records ...idempo.Record) error {
+			return exec(func(store idempo.Store) (err error) {
+				for _, record := range records {
+					if err = store.Save(ctx, record); err != nil {
+						return
+					}
+				}
+				return
+			})
+		}
+		newID = func(name string) string {
+			return prefix + "/" + name
+		}
+		store idempo.Store
+	)
+	err := exec(func(s idempo.Store) error {
+		store = s
+		return nil
+	})
+	assertfatal.EqualError(err, nil, t)
+
+	t.Run("Should save and get a record", func(t *testing.T) {
+		record := newRecord(newID("save"), prefix)
+		assertfatal.EqualError(save(record), nil, t)
+		actual, err := get(record.ID)
+		assertfatal.EqualError(err, nil, t)
+		assertRecord(actual, record, t)
+	})
+
+	t.Run("Should fail to get a missing record", func(t *testing.T) {
+		_, err := get(newID("missing"))
+		assertfatal.EqualError(err, idempo.ErrIdempotencyRecordNotFound, t)
+	})
+
+	t.Run("Should fail to save a duplicate record", func(t *testing.T) {
+		record := newRecord(newID("duplicate"), prefix)
+		assertfatal.EqualError(save(record), nil, t)
+		duplicate := record
+		duplicate.InputHash = "other"
+		assertfatal.Equal(save(duplicate) != nil, true, t)
+		actual, err := get(record.ID)
+		assertfatal.EqualError(err, nil, t)
+		assertRecord(actual, record, t)
+	})
+
+	t.Run("Should roll back records with the unit of work", func(t *testing.T) {
+		var (
+			record      = newRecord(newID("rollback"), prefix)
+			errRollback = errors.New("rollback")
+		)
+		err := exec(func(store idempo.Store) (err error) {
+			if err = store.Save(ctx, record); err != nil {
+				return
+			}
+			return errRollback
+		})
+		assertfatal.EqualError(err, errRollback, t)
+		_, err = get(record.ID)
+		assertfatal.EqualError(err, idempo.ErrIdempotencyRecordNotFound, t)
+	})
+
+	t.Run("Updater", func(t *testing.T) {
+		if _, ok := store.(idempo.Updater); !ok {
+			t.Skip("the Store doesn't implement idempo.Updater")
+		}
+		update := func(record idempo.Record) error {
+			return exec(func(store idempo.Store) error {
+				return store.(idempo.Updater).Update(ctx, record)
+			})
+		}
+
+		t.Run("Should replace a record", func(t *testing.T) {
+			record := newInProgressRecord(newID("update"), prefix, claim(1))
+			assertfatal.EqualError(save(record), nil, t)
+			updated := newRecord(record.ID, prefix)
+			updated.InputHash = "updated"
+			updated.FencingToken = 2
+			assertfatal.EqualError(update(updated), nil, t)
+			actual, err := get(record.ID)
+			assertfatal.EqualError(err, nil, t)
+			assertRecord(actual, updated, t)
+		})
+
+		t.Run("Should fail to update a missing record", func(t *testing.T) {
+			err := update(newRecord(newID("update-missing"), prefix))
+			assertfatal.Equal(errors.Is(err, idempo.ErrIdempotencyRecordNotFound),
+				true, t)
+			_, err = get(newID("update-missing"))
+			assertfatal.EqualError(err, idempo.ErrIdempotencyRecordNotFound, t)
+		})
+	})
+
+	t.Run("Deleter", func(t *testing.T) {
+		if _, ok := store.(idempo.Deleter); !ok {
+			t.Skip("the Store doesn't implement idempo.Deleter")
+		}
+		remove := func(id string) error {
+			return exec(func(store idempo.Store) error {
+				return store.(idempo.Deleter).Delete(ctx, id)
+			})
+		}
+
+		t.Run("Should delete a record", func(t *testing.T) {
+			record := newRecord(newID("delete"), prefix)
+			assertfatal.EqualError(save(record), nil, t)
+			assertfatal.EqualError(remove(record.ID), nil, t)
+			_, err := get(record.ID)
+			assertfatal.EqualError(err, idempo.ErrIdempotencyRecordNotFound, t)
+		})
+
+		t.Run("Should ignore a missing record", func(t *testing.T) {
+			assertfatal.EqualError(remove(newID("delete-missing")), nil, t)
+		})
+	})
+
+	t.Run("FencedStore", func(t *testing.T) {
+		if _, ok := store.(idempo.FencedStore); !ok {
+			t.Skip("the Store doesn't implement idempo.FencedStore")
+		}
+		var (
+			updateFenced = func(claim idempo.Claim, record idempo.Record) error {
+				return exec(func(store idempo.Store) error {
+					return store.(idempo.FencedStore).UpdateFenced(ctx, claim, record)
+				})
+			}
+			deleteFenced = func(claim idempo.Claim, id string) error {
+				return exec(func(store idempo.Store) error {
+					return store.(idempo.FencedStore).DeleteFenced(ctx, claim, id)
+				})
+			}
+			held        = claim(2)
+			wrongOwner  = idempo.Claim{Owner: "owner-2", FencingToken: 2}
+			staleToken  = claim(1)
+			wrongClaims = []idempo.Claim{wrongOwner, staleToken}
+		)
+
+		t.Run("Should update a record held under the claim", func(t *testing.T) {
+			record := newInProgressRecord(newID("fenced-update"), prefix, held)
+			assertfatal.EqualError(save(record), nil, t)
+			// Heartbeat.
+			extended := record
+			extended.LeaseExpiresAt = record.LeaseExpiresAt.Add(time.Hour)
+			assertfatal.EqualError(updateFenced(held, extended), nil, t)
+			actual, err := get(record.ID)
+			assertfatal.EqualError(err, nil, t)
+			assertRecord(actual, extended, t)
+			// Outcome.
+			completed := newRecord(record.ID, prefix)
+			assertfatal.EqualError(updateFenced(held, completed), nil, t)
+			actual, err = get(record.ID)
+			assertfatal.EqualError(err, nil, t)
+			assertRecord(actual, completed, t)
+		})
+
+		t.Run("Should fail to update with a wrong claim", func(t *testing.T) {
+			record := newInProgressRecord(newID("fenced-update-wrong"), prefix,
+				held)
+			assertfatal.EqualError(save(record), nil, t)
+			for _, claim := range wrongClaims {
+				err := updateFenced(claim, newRecord(record.ID, prefix))
+				assertLeaseLost(err, t)
+			}
+			actual, err := get(record.ID)
+			assertfatal.EqualError(err, nil, t)
+			assertRecord(actual, record, t)
+		})
+
+		t.Run("Should fail to update a completed record", func(t *testing.T) {
+			record := newRecord(newID("fenced-update-completed"), prefix)
+			record.LeaseOwner = held.Owner
+			record.FencingToken = held.FencingToken
+			assertfatal.EqualError(save(record), nil, t)
+			updated := record
+			updated.InputHash = "updated"
+			assertLeaseLost(updateFenced(held, updated), t)
+			actual, err := get(record.ID)
+			assertfatal.EqualError(err, nil, t)
+			assertRecord(actual, record, t)
+		})
+
+		t.Run("Should fail to update a missing record", func(t *testing.T) {
+			id := newID("fenced-update-missing")
+			record := newInProgressRecord(id, prefix, held)
+			assertLeaseLost(updateFenced(held, record), t)
+			_, err := get(id)
+			assertfatal.EqualError(err, idempo.ErrIdempotencyRecordNotFound, t)
+		})
+
+		t.Run("Should delete a record held under the claim", func(t *testing.T) {
+			record := newInProgressRecord(newID("fenced-delete"), prefix, held)
+			assertfatal.EqualError(save(record), nil, t)
+			assertfatal.EqualError(deleteFenced(held, record.ID), nil, t)
+			_, err := get(record.ID)
+			assertfatal.EqualError(err, idempo.ErrIdempotencyRecordNotFound, t)
+		})
+
+		t.Run("Should fail to delete with a wrong claim", func(t *testing.T) {
+			record := newInProgressRecord(newID("fenced-delete-wrong"), prefix,
+				held)
+			assertfatal.EqualError(save(record), nil, t)
+			for _, claim := range wrongClaims {
+				assertLeaseLost(deleteFenced(claim, record.ID), t)
+			}
+			actual, err := get(record.ID)
+			assertfatal.EqualError(err, nil, t)
+			assertRecord(actual, record, t)
+		})
+
+		t.Run("Should fail to delete a missing record", func(t *testing.T) {
+			assertLeaseLost(deleteFenced(held, newID("fenced-delete-missing")), t)
+		})
+	})
+
+	t.Run("ScopedStore", func(t *testing.T) {
+		if _, ok := store.(idempo.ScopedStore); !ok {
+			t.Skip("the Store doesn't implement idempo.ScopedStore")
+		}
+		var (
+			scope = prefix + "/scope"
+			other = prefix + "/other"
+			list  = func(scope string) (ids []string, err error) {
+				err = exec(func(store idempo.Store) error {
+					records, err := store.(idempo.ScopedStore).List(ctx, scope)
+					for _, record := range records {
+						ids = append(ids, record.ID)
+					}
+					return err
+				})
+				slices.Sort(ids)
+				return
+			}
+			ids = []string{newID("scoped-1"), newID("scoped-2")}
+		)
+		err := save(newRecord(ids[0], scope), newRecord(ids[1], scope),
+			newRecord(newID("scoped-other"), other))
+		assertfatal.EqualError(err, nil, t)
+
+		t.Run("Should list records of the scope", func(t *testing.T) {
+			actual, err := list(scope)
+			assertfatal.EqualError(err, nil, t)
+			assertfatal.Equal(fmt.Sprint(actual), fmt.Sprint(ids), t)
+		})
+
+		t.Run("Should purge records of the scope", func(t *testing.T) {
+			err := exec(func(store idempo.Store) error {
+				return store.(idempo.ScopedStore).Purge(ctx, scope)
+			})
+			assertfatal.EqualError(err, nil, t)
+			actual, err := list(scope)
+			assertfatal.EqualError(err, nil, t)
+			assertfatal.Equal(len(actual), 0, t)
+			actual, err = list(other)
+			assertfatal.EqualError(err, nil, t)
+			assertfatal.Equal(fmt.Sprint(actual),
+				fmt.Sprint([]string{newID("scoped-other")}), t)
+		})
+	})
+
+	t.Run("BatchStore", func(t *testing.T) {
+		if _, ok := store.(idempo.BatchStore); !ok {
+			t.Skip("the Store doesn't implement idempo.BatchStore")
+		}
+		var (
+			records = []idempo.Record{
+				newRecord(newID("batch-1"), prefix),
+				newInProgressRecord(newID("batch-2"), prefix, claim(1)),
+			}
+			getMany = func(ids []string) (records map[string]idempo.Record,
+				err error,
+			) {
+				err = exec(func(store idempo.Store) (err error) {
+					records, err = store.(idempo.BatchStore).GetMany(ctx, ids)
+					return
+				})
+				return
+			}
+		)
+		err := exec(func(store idempo.Store) error {
+			return store.(idempo.BatchStore).SaveMany(ctx, records)
+		})
+		assertfatal.EqualError(err, nil, t)
+
+		t.Run("Should get saved records and omit missing ones",
+			func(t *testing.T) {
+				actual, err := getMany([]string{records[0].ID, records[1].ID,
+					newID("batch-missing")})
+				assertfatal.EqualError(err, nil, t)
+				assertfatal.Equal(len(actual), 2, t)
+				for _, record := range records {
+					assertRecord(actual[record.ID], record, t)
+				}
+			})
+
+		t.Run("Should get no records for no IDs", func(t *testing.T) {
+			actual, err := getMany(nil)
+			assertfatal.EqualError(err, nil, t)
+			assertfatal.Equal(len(actual), 0, t)
+		})
+	})
+}
+
+func newRecord(id, scope string) idempo.Record {
+	return idempo.Record{
+		ID:            id,
+		InputHash:     "hash",
+		SuccessOutput: true,
+		Output:        []byte(`"output"`),
+		SchemaVersion: 2,
+		Scope:         scope,
+		// Stores may keep times with a lower precision.
+		ExpiresAt: time.Now().Add(time.Hour).Truncate(time.Second),
+	}
+}
+
+func newInProgressRecord(id, scope string, claim idempo.Claim) idempo.Record {
+	return idempo.Record{
+		ID:             id,
+		InputHash:      "hash",
+		Scope:          scope,
+		InProgress:     true,
+		LeaseOwner:     claim.Owner,
+		LeaseExpiresAt: claim.ExpiresAt,
+		FencingToken:   claim.FencingToken,
+	}
+}
+
+func claim(fencingToken uint64) idempo.Claim {
+	return idempo.Claim{
+		Owner:        "owner-1",
+		ExpiresAt:    time.Now().Add(time.Hour).Truncate(time.Second),
+		FencingToken: fencingToken,
+	}
+}
+
+func assertRecord(actual, expected idempo.Record, t *testing.T) {
+	t.Helper()
+	assertfatal.Equal(actual.ID, expected.ID, t)
+	assertfatal.Equal(actual.InputHash, expected.InputHash, t)
+	assertfatal.Equal(actual.SuccessOutput, expected.SuccessOutput, t)
+	assertfatal.Equal(string(actual.Output), string(expected.Output), t)
+	assertfatal.Equal(actual.SchemaVersion, expected.SchemaVersion, t)
+	assertfatal.Equal(actual.Scope, expected.Scope, t)
+	assertfatal.Equal(actual.ExpiresAt.Equal(expected.ExpiresAt), true, t)
+	assertfatal.Equal(actual.InProgress, expected.InProgress, t)
+	assertfatal.Equal(actual.LeaseOwner, expected.LeaseOwner, t)
+	assertfatal.Equal(actual.LeaseExpiresAt.Equal(expected.LeaseExpiresAt), true,
+		t)
+	assertfatal.Equal(actual.FencingToken, expected.FencingToken, t)
+}
+
+func assertLeaseLost(err error, t *testing.T) {
+	t.Helper()
+	assertfatal.Equal(errors.Is(err, idempo.ErrLeaseLost), true, t)
+}
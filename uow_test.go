@@ -0,0 +1,43 @@
+package idempo_test
+
+import (
+	"context"
+	"testing"
+
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+func TestContextUnitOfWork(t *testing.T) {
+	var (
+		unitOfWork = newUnitOfWork(newDB())
+		action     = func(ctx context.Context, repos repos, idempotencyKey string,
+			input transferInput,
+		) (result transferSuccess, err error) {
+			result.TransactionID = ctx.Value(tenantKey{}).(string)
+			return
+		}
+		ctx   = context.WithValue(context.TODO(), tenantKey{}, "tenant-1")
+		input = transferInput{FromAccount: "A", ToAccount: "B", Amount: 1}
+	)
+	for name, unitOfWork := range map[string]idempo.UnitOfWork[repos]{
+		"ContextUnitOfWork": unitOfWork,
+		"UnitOfWork":        executeOnly{unitOfWork},
+	} {
+		t.Run(name, func(t *testing.T) {
+			wrapper := idempo.NewWrapper[repos, transferInput](newConf(unitOfWork))
+			result, err := wrapper.Wrap(ctx, name, input, action)
+			assertfatal.EqualError(err, nil, t)
+			assertfatal.Equal(result.TransactionID, "tenant-1", t)
+		})
+	}
+}
+
+// executeOnly hides the ExecuteContext method of the UnitOfWork.
+type executeOnly struct {
+	unitOfWork idempo.UnitOfWork[repos]
+}
+
+func (u executeOnly) Execute(fn func(repos repos) error) error {
+	return u.unitOfWork.Execute(fn)
+}
@@ -0,0 +1,58 @@
+package idempo
+
+import (
+	"context"
+	"sync"
+)
+
+// NewWorkerPool creates a new WorkerPool with the given number of workers and
+// a queue of queueSize pending jobs.
+func NewWorkerPool(workers, queueSize int) *WorkerPool {
+	p := &WorkerPool{jobs: make(chan func(), queueSize)}
+	p.wg.Add(workers)
+	for range workers {
+		go p.work()
+	}
+	return p
+}
+
+// WorkerPool executes Actions submitted with Wrapper.Submit in the background.
+type WorkerPool struct {
+	jobs   chan func()
+	wg     sync.WaitGroup
+	mu     sync.RWMutex
+	closed bool
+}
+
+// Close stops accepting new jobs and waits for the queued ones to complete.
+func (p *WorkerPool) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+// submit queues the job, blocking if the queue is full.
+func (p *WorkerPool) submit(ctx context.Context, job func()) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrWorkerPoolClosed
+	}
+	select {
+	case p.jobs <- job:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *WorkerPool) work() {
+	defer p.wg.Done()
+	for job := range p.jobs {
+		job()
+	}
+}
@@ -0,0 +1,36 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// ErrStoreNotUpdater is returned by the Saga when the idempotency Store
+// doesn't implement the idempo.Updater interface, required to track the saga
+// state.
+var ErrStoreNotUpdater = idempo.ErrStoreNotUpdater
+
+// ErrCompensationNotRegistered is returned by the Saga when a completed step
+// has to be compensated, but its compensation was not registered, because the
+// step has been neither executed nor replayed since the Saga was re-run.
+var ErrCompensationNotRegistered = errors.New(idempo.ErrorPrefix +
+	"saga step compensation not registered")
+
+// ErrSagaNotRunning is returned by ExecuteSagaStep when a step, that has not
+// been executed before, is executed in a Saga that is no longer running, i.e.
+// is compensating, compensated or completed.
+var ErrSagaNotRunning = errors.New(idempo.ErrorPrefix + "saga is not running")
+
+// StepFailedError is returned when replaying a saga step whose non-retryable
+// failure was persisted. Reason holds the text of the original error.
+type StepFailedError struct {
+	StepName string
+	Reason   string
+}
+
+func (e *StepFailedError) Error() string {
+	return fmt.Sprintf(idempo.ErrorPrefix+"step %q failed: %s", e.StepName,
+		e.Reason)
+}
@@ -0,0 +1,334 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// SagaState is the state of a Saga.
+type SagaState string
+
+const (
+	// SagaRunning means the Saga steps are being executed.
+	SagaRunning SagaState = "running"
+	// SagaCompensating means a step has failed with a non-retryable error and
+	// the completed steps are being compensated.
+	SagaCompensating SagaState = "compensating"
+	// SagaCompensated means all completed steps were compensated.
+	SagaCompensated SagaState = "compensated"
+	// SagaCompleted means all steps were completed.
+	SagaCompleted SagaState = "completed"
+)
+
+// NewSaga creates a new Saga on top of the Workflow.
+//
+// nonRetryable reports whether a step error is a business failure that
+// can't be fixed by retrying, and so triggers compensation.
+func NewSaga[T idempo.UOWRepos](wf Workflow[T],
+	nonRetryable func(err error) bool,
+) *Saga[T] {
+	return &Saga[T]{
+		wf:            wf,
+		nonRetryable:  nonRetryable,
+		compensations: make(map[string]compensation[T]),
+	}
+}
+
+// Saga is a Workflow whose completed steps are compensated, in reverse order,
+// when a later step fails with a non-retryable error.
+//
+// Compensations are idempotent: each is tracked in the idempotency Store under
+// the "<parentKey>/<stepName>/compensation" key. The saga record, stored under
+// the parentKey, holds the saga state, which can be queried with
+// QuerySagaState, and the list of completed steps to compensate. A step is
+// added to the list within its own UnitOfWork, so the list never misses a
+// committed step. Tracking the saga requires the Store to implement the
+// idempo.Updater interface.
+//
+// Compensation functions can't be persisted, so they are registered when
+// their steps are executed or replayed. Re-running a Saga replays its
+// completed steps, so it can be resumed after a crash, including one that
+// happened during compensation. If a completed step has no registered
+// compensation, the compensation fails with ErrCompensationNotRegistered
+// instead of skipping it.
+type Saga[T idempo.UOWRepos] struct {
+	wf            Workflow[T]
+	nonRetryable  func(err error) bool
+	compensations map[string]compensation[T]
+}
+
+// SagaStep is a single step of the Saga.
+type SagaStep[T idempo.UOWRepos, S any] struct {
+	Step[T, S]
+	// Compensate semantically undoes the step, given its output. Optional.
+	Compensate func(ctx context.Context, repos T, stepKey string, output S) error
+}
+
+// Complete marks the Saga as completed. It should be called after the last
+// step.
+func (s *Saga[T]) Complete(ctx context.Context) error {
+	return setSagaState(ctx, s.wf, SagaCompleted)
+}
+
+// compensate runs the compensations of the completed steps, persisted in the
+// saga record, in reverse order.
+func (s *Saga[T]) compensate(ctx context.Context) (err error) {
+	data, err := querySaga(ctx, s.wf.unitOfWork, s.wf.parentKey)
+	if err != nil || data.State == SagaCompensated {
+		return
+	}
+	if err = setSagaState(ctx, s.wf, SagaCompensating); err != nil {
+		return
+	}
+	for i := len(data.Steps) - 1; i >= 0; i-- {
+		stepName := data.Steps[i]
+		c, ok := s.compensations[stepName]
+		if !ok {
+			return fmt.Errorf("%w: step %q", ErrCompensationNotRegistered, stepName)
+		}
+		_, err = Execute(ctx, s.wf, Step[T, struct{}]{
+			Name:       stepName + "/compensation",
+			Serializer: emptySerializer{},
+			Run: func(ctx context.Context, repos T, _ string) (struct{}, error) {
+				return struct{}{}, c(ctx, repos, s.wf.StepKey(stepName))
+			},
+		})
+		if err != nil {
+			return fmt.Errorf(idempo.ErrorPrefix+"failed to compensate step %q: %w",
+				stepName, err)
+		}
+	}
+	return setSagaState(ctx, s.wf, SagaCompensated)
+}
+
+// ExecuteSagaStep executes the step of the Saga, or returns its output if it
+// was already completed.
+//
+// If the step fails with a non-retryable error, the failure is persisted and
+// all previously completed steps are compensated before the error is
+// returned. Replaying such a step returns a *StepFailedError. Retryable errors
+// are not persisted, so the step is executed again when the Saga is re-run.
+//
+// Once the Saga is no longer running, its completed steps can still be
+// replayed, but new steps fail with ErrSagaNotRunning.
+func ExecuteSagaStep[T idempo.UOWRepos, S any](ctx context.Context,
+	saga *Saga[T],
+	step SagaStep[T, S],
+) (output S, err error) {
+	if err = beginSaga(ctx, saga.wf, step.Name); err != nil {
+		return
+	}
+	var (
+		wrapper = newStepWrapper(saga.wf, step.Step, saga.nonRetryable)
+		action  = stepAction(step.Step)
+	)
+	if step.Compensate != nil {
+		action = func(ctx context.Context, repos T, stepKey string,
+			input stepInput,
+		) (output S, err error) {
+			if output, err = step.Run(ctx, repos, stepKey); err != nil {
+				return
+			}
+			// The step is added within its UnitOfWork, so it's committed together
+			// with the step output.
+			err = addSagaStep(ctx, repos, saga.wf, step.Name)
+			return
+		}
+	}
+	output, err = wrapper.Wrap(ctx, saga.wf.StepKey(step.Name),
+		stepInput{saga.wf.input}, action)
+	if err == nil {
+		if step.Compensate != nil {
+			saga.compensations[step.Name] = func(ctx context.Context, repos T,
+				stepKey string,
+			) error {
+				return step.Compensate(ctx, repos, stepKey, output)
+			}
+		}
+		return
+	}
+	var stepFailedErr *StepFailedError
+	if (saga.nonRetryable != nil && saga.nonRetryable(err)) ||
+		errors.As(err, &stepFailedErr) {
+		if compErr := saga.compensate(ctx); compErr != nil {
+			err = compErr
+		}
+	}
+	return
+}
+
+// QuerySagaState returns the state of the Saga with the given parentKey, or
+// idempo.ErrIdempotencyRecordNotFound if it has not been started.
+func QuerySagaState[T idempo.UOWRepos](ctx context.Context,
+	unitOfWork idempo.UnitOfWork[T],
+	parentKey string,
+) (state SagaState, err error) {
+	data, err := querySaga(ctx, unitOfWork, parentKey)
+	state = data.State
+	return
+}
+
+func querySaga[T idempo.UOWRepos](ctx context.Context,
+	unitOfWork idempo.UnitOfWork[T],
+	parentKey string,
+) (data sagaData, err error) {
+	err = unitOfWork.Execute(func(repos T) (err error) {
+		record, err := repos.IdempotencyStore().Get(ctx, parentKey)
+		if err != nil {
+			return
+		}
+		data, err = unmarshalSagaData(record.Output)
+		return
+	})
+	return
+}
+
+// beginSaga saves the saga record in the SagaRunning state, unless the Saga
+// has already been started. Returns idempo.ErrHashMismatch if it was started
+// with a different input, and ErrSagaNotRunning if it is no longer running
+// and the step has not been executed before.
+func beginSaga[T idempo.UOWRepos](ctx context.Context, wf Workflow[T],
+	stepName string,
+) error {
+	return wf.unitOfWork.Execute(func(repos T) (err error) {
+		inputHash, err := wf.input.Hash()
+		if err != nil {
+			return
+		}
+		store := repos.IdempotencyStore()
+		record, err := store.Get(ctx, wf.parentKey)
+		if err == nil {
+			if record.InputHash != inputHash {
+				return idempo.ErrHashMismatch
+			}
+			return checkSagaRunning(ctx, store, wf, record, stepName)
+		}
+		if !errors.Is(err, idempo.ErrIdempotencyRecordNotFound) {
+			return
+		}
+		record, err = sagaRecord(wf, inputHash, sagaData{State: SagaRunning})
+		if err != nil {
+			return
+		}
+		return store.Save(ctx, record)
+	})
+}
+
+// checkSagaRunning returns ErrSagaNotRunning if the Saga of the record is no
+// longer running and the step has no record, i.e. it would be executed.
+func checkSagaRunning[T idempo.UOWRepos](ctx context.Context,
+	store idempo.Store,
+	wf Workflow[T],
+	record idempo.Record,
+	stepName string,
+) (err error) {
+	data, err := unmarshalSagaData(record.Output)
+	if err != nil || data.State == SagaRunning {
+		return
+	}
+	_, err = store.Get(ctx, idempo.Key{IdempotencyKey: wf.StepKey(stepName)}.ID())
+	if errors.Is(err, idempo.ErrIdempotencyRecordNotFound) {
+		return ErrSagaNotRunning
+	}
+	return
+}
+
+func setSagaState[T idempo.UOWRepos](ctx context.Context, wf Workflow[T],
+	state SagaState,
+) error {
+	return wf.unitOfWork.Execute(func(repos T) error {
+		return updateSaga(ctx, repos, wf, func(data *sagaData) {
+			data.State = state
+		})
+	})
+}
+
+// addSagaStep adds the completed step to the saga record.
+func addSagaStep[T idempo.UOWRepos](ctx context.Context, repos T,
+	wf Workflow[T],
+	stepName string,
+) error {
+	return updateSaga(ctx, repos, wf, func(data *sagaData) {
+		if !slices.Contains(data.Steps, stepName) {
+			data.Steps = append(data.Steps, stepName)
+		}
+	})
+}
+
+func updateSaga[T idempo.UOWRepos](ctx context.Context, repos T,
+	wf Workflow[T],
+	fn func(data *sagaData),
+) (err error) {
+	store := repos.IdempotencyStore()
+	updater, ok := store.(idempo.Updater)
+	if !ok {
+		return ErrStoreNotUpdater
+	}
+	record, err := store.Get(ctx, wf.parentKey)
+	if err != nil {
+		return
+	}
+	data, err := unmarshalSagaData(record.Output)
+	if err != nil {
+		return
+	}
+	fn(&data)
+	if record, err = sagaRecord(wf, record.InputHash, data); err != nil {
+		return
+	}
+	return updater.Update(ctx, record)
+}
+
+func sagaRecord[T idempo.UOWRepos](wf Workflow[T], inputHash string,
+	data sagaData,
+) (record idempo.Record, err error) {
+	output, err := json.Marshal(data)
+	if err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"failed to marshal saga record: %w", err)
+		return
+	}
+	record = idempo.Record{
+		ID:            wf.parentKey,
+		InputHash:     inputHash,
+		SuccessOutput: true,
+		Output:        output,
+	}
+	return
+}
+
+// sagaData is the output of the saga record.
+type sagaData struct {
+	State SagaState `json:"state"`
+	// Steps lists the completed steps with compensations, in the order of
+	// completion.
+	Steps []string `json:"steps,omitempty"`
+}
+
+// unmarshalSagaData decodes the saga record output.
+func unmarshalSagaData(bs []byte) (data sagaData, err error) {
+	if err = json.Unmarshal(bs, &data); err != nil {
+		err = fmt.Errorf(idempo.ErrorPrefix+"failed to unmarshal saga record: %w",
+			err)
+	}
+	return
+}
+
+// compensation is the registered compensation of a completed step.
+type compensation[T idempo.UOWRepos] func(ctx context.Context, repos T,
+	stepKey string) error
+
+// emptySerializer serializes outputs of compensations, which have none.
+type emptySerializer struct{}
+
+func (s emptySerializer) Marshal(v struct{}) ([]byte, error) {
+	return nil, nil
+}
+
+func (s emptySerializer) Unmarshal(bs []byte) (struct{}, error) {
+	return struct{}{}, nil
+}
@@ -0,0 +1,130 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+	serializer "github.com/ymz-ncnk/idempo-go/serializer/json"
+)
+
+func TestSaga(t *testing.T) {
+	var (
+		unitOfWork     = newUnitOfWork(t)
+		errRejected    = errors.New("rejected")
+		errUnavailable = errors.New("service unavailable")
+		isBusiness     = func(err error) bool { return errors.Is(err, errRejected) }
+		compensated    []string
+		step           = func(name string, err error) SagaStep[repos, string] {
+			return SagaStep[repos, string]{
+				Step: Step[repos, string]{
+					Name:       name,
+					Serializer: serializer.JSONSerializer[string]{},
+					Run: func(ctx context.Context, repos repos, stepKey string) (
+						string, error,
+					) {
+						return name, err
+					},
+				},
+				Compensate: func(ctx context.Context, repos repos, stepKey string,
+					output string,
+				) error {
+					compensated = append(compensated, output)
+					return nil
+				},
+			}
+		}
+		run = func(parentKey string, steps ...SagaStep[repos, string]) error {
+			saga := NewSaga(New(unitOfWork, parentKey, input("A->B:1")), isBusiness)
+			for _, step := range steps {
+				if _, err := ExecuteSagaStep(context.TODO(), saga, step); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	)
+
+	t.Run("Should persist completed steps with the saga record",
+		func(t *testing.T) {
+			err := run("order-1", step("reservation", nil), step("payment", nil),
+				step("shipment", errUnavailable))
+			assertfatal.EqualError(err, errUnavailable, t)
+			data := getSaga(t, unitOfWork, "order-1")
+			assertfatal.Equal(data.State, SagaRunning, t)
+			assertfatal.Equal(strings.Join(data.Steps, ","), "reservation,payment", t)
+		})
+
+	t.Run("Should compensate persisted steps in reverse order after re-run",
+		func(t *testing.T) {
+			err := run("order-1", step("reservation", nil), step("payment", nil),
+				step("shipment", errRejected))
+			assertfatal.EqualError(err, errRejected, t)
+			assertfatal.Equal(strings.Join(compensated, ","), "payment,reservation", t)
+			assertfatal.Equal(getSaga(t, unitOfWork, "order-1").State,
+				SagaCompensated, t)
+		})
+
+	t.Run("Should fail if a compensation is not registered", func(t *testing.T) {
+		err := run("order-2", step("reservation", nil))
+		assertfatal.EqualError(err, nil, t)
+
+		err = run("order-2", step("payment", errRejected))
+		assertfatal.Equal(errors.Is(err, ErrCompensationNotRegistered), true, t)
+		assertfatal.Equal(getSaga(t, unitOfWork, "order-2").State,
+			SagaCompensating, t)
+	})
+
+	t.Run("Should fail with ErrHashMismatch for another input",
+		func(t *testing.T) {
+			saga := NewSaga(New(unitOfWork, "order-1", input("A->B:2")), isBusiness)
+			_, err := ExecuteSagaStep(context.TODO(), saga, step("reservation", nil))
+			assertfatal.EqualError(err, idempo.ErrHashMismatch, t)
+		})
+
+	t.Run("Should not execute new steps of a compensated saga",
+		func(t *testing.T) {
+			err := run("order-1", step("reservation", nil))
+			assertfatal.EqualError(err, nil, t)
+			err = run("order-1", step("refund", nil))
+			assertfatal.EqualError(err, ErrSagaNotRunning, t)
+		})
+
+	t.Run("Should not execute new steps of a completed saga",
+		func(t *testing.T) {
+			saga := NewSaga(New(unitOfWork, "order-3", input("A->B:1")), isBusiness)
+			_, err := ExecuteSagaStep(context.TODO(), saga, step("reservation", nil))
+			assertfatal.EqualError(err, nil, t)
+			assertfatal.EqualError(saga.Complete(context.TODO()), nil, t)
+			state, err := QuerySagaState(context.TODO(), unitOfWork, "order-3")
+			assertfatal.EqualError(err, nil, t)
+			assertfatal.Equal(state, SagaCompleted, t)
+
+			err = run("order-3", step("reservation", nil), step("payment", nil))
+			assertfatal.EqualError(err, ErrSagaNotRunning, t)
+		})
+
+	t.Run("Should not compensate steps without a compensation",
+		func(t *testing.T) {
+			compensated = nil
+			noCompensation := step("notification", nil)
+			noCompensation.Compensate = nil
+			err := run("order-4", noCompensation, step("payment", errRejected))
+			assertfatal.EqualError(err, errRejected, t)
+			assertfatal.Equal(len(compensated), 0, t)
+			data := getSaga(t, unitOfWork, "order-4")
+			assertfatal.Equal(slices.Contains(data.Steps, "notification"), false, t)
+		})
+}
+
+func getSaga(t *testing.T, unitOfWork idempo.UnitOfWork[repos],
+	parentKey string,
+) sagaData {
+	data, err := querySaga(context.TODO(), unitOfWork, parentKey)
+	assertfatal.EqualError(err, nil, t)
+	return data
+}
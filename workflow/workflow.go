@@ -0,0 +1,115 @@
+package workflow
+
+import (
+	"context"
+
+	"github.com/ymz-ncnk/idempo-go"
+)
+
+// New creates a new Workflow identified by parentKey.
+//
+// input is the workflow input. Its hash is persisted with every step Record,
+// so reusing parentKey with a different input fails with
+// idempo.ErrHashMismatch.
+func New[T idempo.UOWRepos](unitOfWork idempo.UnitOfWork[T], parentKey string,
+	input idempo.Hasher,
+) Workflow[T] {
+	return Workflow[T]{unitOfWork: unitOfWork, parentKey: parentKey, input: input}
+}
+
+// Workflow is a multi-step operation, where each step is checkpointed as a
+// separate idempotency Record.
+//
+// Long operations that call several external services can't be wrapped in a
+// single transaction. Instead, each step is executed in its own UnitOfWork and
+// its output is stored under the "<parentKey>/<stepName>" key. Re-running the
+// Workflow after a crash returns cached outputs for finished steps and resumes
+// from the first incomplete one.
+type Workflow[T idempo.UOWRepos] struct {
+	unitOfWork idempo.UnitOfWork[T]
+	parentKey  string
+	input      idempo.Hasher
+}
+
+// ParentKey returns the key of the Workflow.
+func (w Workflow[T]) ParentKey() string {
+	return w.parentKey
+}
+
+// StepKey returns the idempotency key of the step with the given name.
+func (w Workflow[T]) StepKey(stepName string) string {
+	return w.parentKey + "/" + stepName
+}
+
+// Step is a single step of the Workflow, producing the output S.
+type Step[T idempo.UOWRepos, S any] struct {
+	// Name identifies the step within the Workflow.
+	Name string
+	// Serializer serializes the step output for storage.
+	Serializer idempo.Serializer[S]
+	// Run performs the step. It is executed within the step UnitOfWork and
+	// receives the step idempotency key, which should be passed to external
+	// services that support it.
+	Run func(ctx context.Context, repos T, stepKey string) (S, error)
+}
+
+// Execute executes the step of the Workflow, or returns its output if it was
+// already completed. Step errors are not persisted, so a failed step is
+// executed again when the Workflow is re-run.
+func Execute[T idempo.UOWRepos, S any](ctx context.Context, wf Workflow[T],
+	step Step[T, S],
+) (output S, err error) {
+	return newStepWrapper(wf, step, nil).Wrap(ctx, wf.StepKey(step.Name),
+		stepInput{wf.input}, stepAction(step))
+}
+
+// newStepWrapper creates a Wrapper that persists step outputs and, if
+// persistFailure is specified, step failures for which it returns true.
+func newStepWrapper[T idempo.UOWRepos, S any](wf Workflow[T], step Step[T, S],
+	persistFailure func(err error) bool,
+) idempo.Wrapper[T, stepInput, S, string] {
+	conf := idempo.Config[T, S, string]{
+		UnitOfWork: wf.unitOfWork,
+		SuccessSer: step.Serializer,
+		FailureSer: failureSerializer{},
+		ErrorToFailure: func(err error) (idempo.Persistence, string) {
+			if persistFailure != nil && persistFailure(err) {
+				return idempo.PersistPermanent, err.Error()
+			}
+			return idempo.PersistNone, ""
+		},
+		FailureToError: func(failure string) error {
+			return &StepFailedError{StepName: step.Name, Reason: failure}
+		},
+	}
+	return idempo.NewWrapper[T, stepInput](conf)
+}
+
+func stepAction[T idempo.UOWRepos, S any](step Step[T, S],
+) idempo.Action[T, stepInput, S] {
+	return func(ctx context.Context, repos T, stepKey string, input stepInput) (
+		S, error,
+	) {
+		return step.Run(ctx, repos, stepKey)
+	}
+}
+
+// stepInput makes all steps of the Workflow share the workflow input hash.
+type stepInput struct {
+	input idempo.Hasher
+}
+
+func (i stepInput) Hash() (string, error) {
+	return i.input.Hash()
+}
+
+// failureSerializer stores step failures as plain text.
+type failureSerializer struct{}
+
+func (s failureSerializer) Marshal(v string) ([]byte, error) {
+	return []byte(v), nil
+}
+
+func (s failureSerializer) Unmarshal(bs []byte) (string, error) {
+	return string(bs), nil
+}
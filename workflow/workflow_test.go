@@ -0,0 +1,117 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	memdb "github.com/hashicorp/go-memdb"
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+	serializer "github.com/ymz-ncnk/idempo-go/serializer/json"
+	uow "github.com/ymz-ncnk/idempo-go/uow/memdb"
+)
+
+func TestWorkflow(t *testing.T) {
+	var (
+		unitOfWork     = newUnitOfWork(t)
+		errUnavailable = errors.New("service unavailable")
+		calls          int
+		fail           = true
+		step           = Step[repos, string]{
+			Name:       "payment",
+			Serializer: serializer.JSONSerializer[string]{},
+			Run: func(ctx context.Context, repos repos, stepKey string) (
+				output string, err error,
+			) {
+				calls++
+				if fail {
+					err = errUnavailable
+					return
+				}
+				return "paid:" + stepKey, nil
+			},
+		}
+	)
+	wf := New(unitOfWork, "order-1", input("A->B:1"))
+	_, err := Execute(context.TODO(), wf, step)
+	assertfatal.EqualError(err, errUnavailable, t)
+
+	t.Run("Should not persist step errors", func(t *testing.T) {
+		_, err := getRecord(unitOfWork, "order-1/payment")
+		assertfatal.EqualError(err, idempo.ErrIdempotencyRecordNotFound, t)
+	})
+
+	t.Run("Should execute a failed step again", func(t *testing.T) {
+		fail = false
+		output, err := Execute(context.TODO(), wf, step)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(output, "paid:order-1/payment", t)
+		assertfatal.Equal(calls, 2, t)
+	})
+
+	t.Run("Should replay a completed step", func(t *testing.T) {
+		output, err := Execute(context.TODO(), wf, step)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(output, "paid:order-1/payment", t)
+		assertfatal.Equal(calls, 2, t)
+	})
+
+	t.Run("Should fail with ErrHashMismatch for another input",
+		func(t *testing.T) {
+			wf := New(unitOfWork, "order-1", input("A->B:2"))
+			_, err := Execute(context.TODO(), wf, step)
+			assertfatal.EqualError(err, idempo.ErrHashMismatch, t)
+			assertfatal.Equal(calls, 2, t)
+		})
+}
+
+type input string
+
+func (in input) Hash() (string, error) {
+	return string(in), nil
+}
+
+type repos struct {
+	store idempo.Store
+}
+
+func (r repos) IdempotencyStore() idempo.Store {
+	return r.store
+}
+
+func newUnitOfWork(t *testing.T) *uow.UnitOfWork[repos] {
+	db, err := memdb.NewMemDB(&memdb.DBSchema{
+		Tables: map[string]*memdb.TableSchema{
+			uow.MemDBIdempotencyTableName: {
+				Name: uow.MemDBIdempotencyTableName,
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": {
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "ID"},
+					},
+					uow.MemDBScopeIndexName: {
+						Name:         uow.MemDBScopeIndexName,
+						AllowMissing: true,
+						Indexer:      &memdb.StringFieldIndex{Field: "Scope"},
+					},
+				},
+			},
+		},
+	})
+	assertfatal.EqualError(err, nil, t)
+	return uow.NewUnitOfWork(db, func(tx *memdb.Txn) repos {
+		return repos{uow.NewIdempotencyStore(tx)}
+	})
+}
+
+func getRecord(unitOfWork idempo.UnitOfWork[repos], id string) (
+	record idempo.Record, err error,
+) {
+	err = unitOfWork.Execute(func(repos repos) (err error) {
+		record, err = repos.IdempotencyStore().Get(context.TODO(), id)
+		return
+	})
+	return
+}
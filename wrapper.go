@@ -2,12 +2,16 @@ package idempo
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
 )
 
 // ErrorToFailure defines the function that converts a Go 'error' into the
 // storable failure output ('F').
-type ErrorToFailure[F any] func(err error) (bool, F)
+type ErrorToFailure[F any] func(err error) (Persistence, F)
 
 // NewWrapper creates a new instance of the Wrapper.
 func NewWrapper[T UOWRepos, I Hasher, S, F any](
@@ -15,7 +19,29 @@ func NewWrapper[T UOWRepos, I Hasher, S, F any](
 ) Wrapper[T, I, S, F] {
 	storeAdapter := NewStoreAdapter(conf.SuccessSer, conf.FailureSer,
 		conf.FailureToError)
-	return Wrapper[T, I, S, F]{conf.UnitOfWork, storeAdapter, conf.ErrorToFailure}
+	lease := conf.Lease
+	if lease.Duration > 0 && lease.OwnerID == "" {
+		lease.OwnerID = uuid.NewString()
+	}
+	var singleFlight *singleFlight[S]
+	if conf.SingleFlight {
+		singleFlight = newSingleFlight[S]()
+	}
+	return Wrapper[T, I, S, F]{
+		unitOfWork:     conf.UnitOfWork,
+		storeAdapter:   storeAdapter,
+		errorToFailure: conf.ErrorToFailure,
+		inputHasher:    conf.InputHasher,
+		rewriteHash:    conf.RewriteInputHash,
+		hashVersions:   conf.HashVersions,
+		keyScope:       conf.KeyScope,
+		keyValidator:   conf.KeyValidator,
+		workerPool:     conf.WorkerPool,
+		lease:          lease,
+		singleFlight:   singleFlight,
+		retryPolicy:    conf.RetryPolicy.withDefaults(),
+		locker:         conf.Locker,
+	}
 }
 
 // Wrapper is the core type that enforces idempotency for a protected Action.
@@ -33,65 +59,294 @@ type Wrapper[T UOWRepos, I Hasher, S, F any] struct {
 	unitOfWork     UnitOfWork[T]
 	storeAdapter   StoreAdapter[S, F]
 	errorToFailure ErrorToFailure[F]
+	inputHasher    InputHasher
+	rewriteHash    bool
+	hashVersions   []string
+	keyScope       KeyScope
+	keyValidator   KeyValidator
+	workerPool     *WorkerPool
+	lease          Lease
+	singleFlight   *singleFlight[S]
+	retryPolicy    RetryPolicy
+	locker         Locker
 }
 
 // Wrap executes the provided Action idempotently.
 //
-//  1. It calculates a hash of the input (I).
-//  2. Executes the UnitOfWork (UOW):
-//     a. Checks the Store for a record associated with idempotencyKey. If
+//  1. It validates idempotencyKey with the KeyValidator, if configured, and
+//     calculates a hash of the input (I) with Hasher.Hash or the configured
+//     HashVersions, applying the InputHasher if configured.
+//  2. Composes idempotencyKey with the KeyScope, if configured.
+//  3. Executes the UnitOfWork (UOW):
+//     a. Checks the Store for a record associated with the key. If
 //     found, and its hash is equal to the hash of the input (I) returns the
 //     stored result.
 //     b. If no record is found, executes the core Action.
 //     c. If the Action succeeds, saves the success output.
 //     d. If the Action fails, with errorToFailure it tries to get and persist
-//     a failure output.
-//  3. The UOW ensures the Action's side effects and the idempotency record
+//     a failure output, permanently or for a limited time.
+//  4. The UOW ensures the Action's side effects and the idempotency record
 //     persistence are completed together or roll back completely.
+//
+// If SingleFlight is enabled in the Config, concurrent calls with the same key
+// share step 3, see Config.SingleFlight. If the UOW fails with a transient
+// error, it is retried according to the RetryPolicy. If the Config defines a
+// Locker, the lock for the key is held during step 3.
 func (w Wrapper[T, I, S, F]) Wrap(ctx context.Context, idempotencyKey string,
 	input I,
 	action Action[T, I, S],
 ) (successOutput S, err error) {
-	hash, err := input.Hash()
+	key, inputHash, err := w.prepare(ctx, idempotencyKey, input)
+	if err != nil {
+		return
+	}
+	if w.singleFlight != nil {
+		return w.wrapSingleFlight(ctx, key, inputHash, input, action)
+	}
+	successOutput, _, err = w.wrap(ctx, key, inputHash, input, action)
+	return
+}
+
+// wrap executes the Action within a new UnitOfWork. committed is false if the
+// UnitOfWork was rolled back.
+func (w Wrapper[T, I, S, F]) wrap(ctx context.Context, key Key,
+	inputHash InputHash,
+	input I,
+	action Action[T, I, S],
+) (successOutput S, committed bool, err error) {
+	unlock, err := w.lock(ctx, key)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	execErr := w.executeUnitOfWork(ctx, func(ctx context.Context,
+		repos T,
+	) (fnErr error) {
+		successOutput, err, fnErr = w.execute(ctx, repos, repos.IdempotencyStore(),
+			key, inputHash, input, action)
+		return
+	})
+	if execErr != nil {
+		err = execErr
+		return
+	}
+	committed = true
+	return
+}
+
+// WrapIn executes the provided Action idempotently within an already running
+// UnitOfWork, using the given repos.
+//
+// It performs the same steps as Wrap, but doesn't open a UnitOfWork of its
+// own, so several idempotent Actions (of one or more Wrappers sharing the same
+// repository bundle type) can be composed or nested and committed together:
+//
+//	err := unitOfWork.Execute(func(repos T) error {
+//		reservation, err := stockWrapper.WrapIn(ctx, repos, stockKey,
+//			stockInput, reserveStock)
+//		if err != nil {
+//			return err
+//		}
+//		...
+//		_, err = orderWrapper.WrapIn(ctx, repos, orderKey, orderInput,
+//			createOrder)
+//		return err
+//	})
+//
+// Any returned error should roll back the enclosing UnitOfWork. Note that
+// this also rolls back a persisted failure output, so the next attempt
+// re-executes the Action.
+func (w Wrapper[T, I, S, F]) WrapIn(ctx context.Context, repos T,
+	idempotencyKey string,
+	input I,
+	action Action[T, I, S],
+) (successOutput S, err error) {
+	key, inputHash, err := w.prepare(ctx, idempotencyKey, input)
+	if err != nil {
+		return
+	}
+	successOutput, outputErr, fnErr := w.execute(ctx, repos,
+		repos.IdempotencyStore(), key, inputHash, input, action)
+	if fnErr != nil {
+		err = fnErr
+		return
+	}
+	err = outputErr
+	return
+}
+
+// prepare validates the idempotency key, composes it with the KeyScope and
+// calculates the input hash.
+func (w Wrapper[T, I, S, F]) prepare(ctx context.Context, idempotencyKey string,
+	input I,
+) (key Key, inputHash InputHash, err error) {
+	if w.keyValidator != nil {
+		if err = w.keyValidator.Validate(idempotencyKey); err != nil {
+			return
+		}
+	}
+	inputHash, err = w.inputHash(input)
 	if err != nil {
 		err = fmt.Errorf("idempotency wrapper failed to calculate input hash: %w", err)
 		return
 	}
-	execErr := w.unitOfWork.Execute(func(repos T) (fnErr error) {
-		// Idempotency Check
-		var ok bool
-		ok, successOutput, fnErr = w.storeAdapter.AlreadyProcessed(ctx, idempotencyKey,
-			hash, repos.IdempotencyStore())
-		if ok || fnErr != nil {
+	key, err = w.key(ctx, idempotencyKey)
+	return
+}
+
+// execute performs the idempotency check, runs the Action and saves its output
+// within the current transaction.
+//
+// outputErr is an error for the caller that doesn't require a rollback: a
+// replayed or persisted failure, ErrHashMismatch or ErrInProgress. fnErr
+// requires the transaction to be rolled back.
+func (w Wrapper[T, I, S, F]) execute(ctx context.Context, repos T, store Store,
+	key Key,
+	inputHash InputHash,
+	input I,
+	action Action[T, I, S],
+) (successOutput S, outputErr, fnErr error) {
+	// Idempotency Check
+	ok, successOutput, err := w.storeAdapter.AlreadyProcessed(ctx, key,
+		inputHash, store)
+	if errors.Is(err, ErrInProgress) {
+		// The in-progress Record with an expired lease is taken over.
+		var takenOver bool
+		if takenOver, err = w.takeOverExpired(ctx, store, key); err == nil &&
+			!takenOver {
+			err = ErrInProgress
+		}
+	}
+	if ok || errors.Is(err, ErrHashMismatch) || errors.Is(err, ErrInProgress) {
+		outputErr = err
+		return
+	}
+	if err != nil {
+		fnErr = err
+		return
+	}
+	// Execute Action
+	successOutput, err = action(ctx, repos, key.IdempotencyKey, input)
+	outputErr, fnErr = w.saveOutcome(ctx, store, key, inputHash, successOutput,
+		err)
+	return
+}
+
+// saveOutcome saves the success output, or the failure output if actionErr
+// should be persisted.
+func (w Wrapper[T, I, S, F]) saveOutcome(ctx context.Context, store Store,
+	key Key,
+	inputHash InputHash,
+	successOutput S,
+	actionErr error,
+) (outputErr, fnErr error) {
+	if actionErr != nil {
+		// Handle Failure: Business or System Error
+		persistence, failOutput := w.errorToFailure(actionErr)
+		if !persistence.Persist() {
+			fnErr = actionErr
 			return
 		}
-		// Execute Action
-		successOutput, fnErr = action(ctx, repos, idempotencyKey, input)
-		if fnErr != nil {
-			// Handle Failure: Business or System Error
-			isBusinessError, failOutput := w.errorToFailure(fnErr)
-			if isBusinessError {
-				// Business logic failure (e.g., OCC failed, Stock unavailable). Save
-				// the fail record.
-				if storeErr := w.storeAdapter.SaveFailOutput(ctx, idempotencyKey, hash,
-					failOutput, repos.IdempotencyStore()); storeErr != nil {
-					fnErr = NewFailureOutputStoreError(storeErr, fnErr)
-				} else {
-					err = fnErr
-					fnErr = nil
-				}
-			}
+		// Business logic failure (e.g., OCC failed, Stock unavailable). Save
+		// the fail record.
+		if storeErr := w.storeAdapter.SaveFailOutput(ctx, key, inputHash.Value,
+			failOutput, persistence.TTL(), store); storeErr != nil {
+			fnErr = NewFailureOutputStoreError(storeErr, actionErr)
 			return
 		}
-		// Action SUCCEEDED. Save the success record.
-		if storeErr := w.storeAdapter.SaveSuccessOutput(ctx, idempotencyKey, hash,
-			successOutput, repos.IdempotencyStore()); storeErr != nil {
-			fnErr = NewSuccessOutputStoreError(storeErr)
+		outputErr = actionErr
+		return
+	}
+	// Action SUCCEEDED. Save the success record.
+	if storeErr := w.storeAdapter.SaveSuccessOutput(ctx, key, inputHash.Value,
+		successOutput, store); storeErr != nil {
+		fnErr = NewSuccessOutputStoreError(storeErr)
+	}
+	return
+}
+
+func (w Wrapper[T, I, S, F]) key(ctx context.Context, idempotencyKey string) (
+	key Key, err error,
+) {
+	key.IdempotencyKey = idempotencyKey
+	if w.keyScope.Operation == "" && w.keyScope.Tenant == nil {
+		return
+	}
+	key.Scope, err = w.keyScope.Scope(ctx)
+	return
+}
+
+func (w Wrapper[T, I, S, F]) inputHash(input I) (inputHash InputHash,
+	err error,
+) {
+	if len(w.hashVersions) > 0 {
+		inputHash, err = w.versionedInputHash(input)
+	} else {
+		inputHash, err = w.untaggedInputHash(input)
+	}
+	inputHash.Rewrite = w.rewriteHash
+	return
+}
+
+func (w Wrapper[T, I, S, F]) untaggedInputHash(input I) (inputHash InputHash,
+	err error,
+) {
+	raw, err := input.Hash()
+	if err != nil {
+		return
+	}
+	return w.applyInputHasher(raw)
+}
+
+// versionedInputHash calculates the hash of the newest hash version. The
+// hashes of the version a stored hash is tagged with, or the untagged one,
+// are calculated only when the stored hash is compared.
+func (w Wrapper[T, I, S, F]) versionedInputHash(input I) (
+	inputHash InputHash, err error,
+) {
+	hasher, ok := any(input).(VersionedHasher)
+	if !ok {
+		err = ErrNotVersionedHasher
+		return
+	}
+	newest := w.hashVersions[len(w.hashVersions)-1]
+	if inputHash, err = w.taggedInputHash(hasher, newest); err != nil {
+		return
+	}
+	inputHash.resolve = func(stored string) (InputHash, error) {
+		tag, tagged := hashTag(stored)
+		switch {
+		case !tagged:
+			return w.untaggedInputHash(input)
+		case tag != newest && slices.Contains(w.hashVersions, tag):
+			return w.taggedInputHash(hasher, tag)
+		default:
+			return InputHash{}, nil
 		}
+	}
+	return
+}
+
+func (w Wrapper[T, I, S, F]) taggedInputHash(hasher VersionedHasher,
+	tag string,
+) (inputHash InputHash, err error) {
+	raw, err := hasher.HashVersion(tag)
+	if err != nil {
 		return
-	})
-	if execErr != nil {
-		err = execErr
+	}
+	if inputHash, err = w.applyInputHasher(raw); err != nil {
+		return
+	}
+	inputHash.Value = taggedHash(tag, inputHash.Value)
+	for i, hash := range inputHash.Previous {
+		inputHash.Previous[i] = taggedHash(tag, hash)
 	}
 	return
 }
+
+func (w Wrapper[T, I, S, F]) applyInputHasher(raw string) (InputHash, error) {
+	if w.inputHasher == nil {
+		return InputHash{Value: raw}, nil
+	}
+	return w.inputHasher.InputHash(raw)
+}
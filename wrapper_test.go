@@ -0,0 +1,236 @@
+package idempo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	assertfatal "github.com/ymz-ncnk/assert/fatal"
+	"github.com/ymz-ncnk/idempo-go"
+	uow "github.com/ymz-ncnk/idempo-go/uow/memdb"
+)
+
+func TestHashVersions(t *testing.T) {
+	var (
+		db             = newDB()
+		unitOfWork     = newUnitOfWork(db)
+		idempotencyKey = "transfer-123"
+		input          = transferInput{
+			FromAccount: "A",
+			ToAccount:   "B",
+			Amount:      500,
+		}
+	)
+	// Request made before hash versioning was introduced.
+	first, err := idempo.NewWrapper[repos, transferInput](newConf(unitOfWork)).
+		Wrap(context.TODO(), idempotencyKey, input, transfer)
+	assertfatal.EqualError(err, nil, t)
+
+	conf := newConf(unitOfWork)
+	conf.HashVersions = []string{"v1"}
+	wrapper := idempo.NewWrapper[repos, transferInput](conf)
+
+	t.Run("Should replay record saved with untagged hash", func(t *testing.T) {
+		result, err := wrapper.Wrap(context.TODO(), idempotencyKey, input, transfer)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(result, first, t)
+		assertfatal.Equal(getBalance(db, input.FromAccount), 500, t)
+	})
+
+	t.Run("Should save records with the newest hash version", func(t *testing.T) {
+		idempotencyKey := "transfer-456"
+		_, err := wrapper.Wrap(context.TODO(), idempotencyKey, input, transfer)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(getRecord(db, idempotencyKey).InputHash, "$v1$A->B:500", t)
+	})
+
+	t.Run("Should detect hash mismatch", func(t *testing.T) {
+		input := input
+		input.Amount = 1
+		_, err := wrapper.Wrap(context.TODO(), idempotencyKey, input, transfer)
+		assertfatal.EqualError(err, idempo.ErrHashMismatch, t)
+	})
+
+	var (
+		calls = map[string]int{}
+		noop  = func(ctx context.Context, repos repos, idempotencyKey string,
+			input countingInput,
+		) (result transferSuccess, err error) {
+			return
+		}
+	)
+	conf.HashVersions = []string{"v1", "v2"}
+	conf.RewriteInputHash = true
+	countingWrapper := idempo.NewWrapper[repos, countingInput](conf)
+
+	t.Run("Should hash only with the newest and the stored versions",
+		func(t *testing.T) {
+			_, err := countingWrapper.Wrap(context.TODO(), "transfer-456",
+				countingInput{input, calls}, noop)
+			assertfatal.EqualError(err, nil, t)
+			assertfatal.Equal(calls["v1"], 1, t)
+			assertfatal.Equal(calls["v2"], 1, t)
+		})
+
+	t.Run("Should rewrite record saved with an older version", func(t *testing.T) {
+		assertfatal.Equal(getRecord(db, "transfer-456").InputHash,
+			"$v2$500:A->B", t)
+
+		clear(calls)
+		_, err := countingWrapper.Wrap(context.TODO(), "transfer-456",
+			countingInput{input, calls}, noop)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(calls["v1"], 0, t)
+		assertfatal.Equal(calls["v2"], 1, t)
+	})
+
+	t.Run("Should fail if input is not a VersionedHasher", func(t *testing.T) {
+		wrapper := idempo.NewWrapper[repos, untaggedInput](conf)
+		_, err := wrapper.Wrap(context.TODO(), "transfer-789",
+			untaggedInput{input}, func(ctx context.Context, repos repos,
+				idempotencyKey string, input untaggedInput,
+			) (result transferSuccess, err error) {
+				return
+			})
+		assertfatal.Equal(errors.Is(err, idempo.ErrNotVersionedHasher), true, t)
+	})
+}
+
+// countingInput counts the calculated hashes of each version.
+type countingInput struct {
+	transferInput
+	calls map[string]int
+}
+
+func (in countingInput) HashVersion(tag string) (string, error) {
+	in.calls[tag]++
+	return in.transferInput.HashVersion(tag)
+}
+
+// untaggedInput implements only the idempo.Hasher interface.
+type untaggedInput struct {
+	input transferInput
+}
+
+func (in untaggedInput) Hash() (string, error) {
+	return in.input.Hash()
+}
+
+func TestKeyScope(t *testing.T) {
+	var (
+		db   = newDB()
+		conf = newConf(newUnitOfWork(db))
+	)
+	conf.KeyScope = idempo.KeyScope{
+		Operation: "transfer",
+		Tenant: func(ctx context.Context) (string, error) {
+			return ctx.Value(tenantKey{}).(string), nil
+		},
+	}
+	var (
+		wrapper        = idempo.NewWrapper[repos, transferInput](conf)
+		idempotencyKey = "transfer-123"
+		tenant1Ctx     = context.WithValue(context.TODO(), tenantKey{}, "tenant-1")
+		tenant2Ctx     = context.WithValue(context.TODO(), tenantKey{}, "tenant-2")
+	)
+	result1, err := wrapper.Wrap(tenant1Ctx, idempotencyKey,
+		transferInput{FromAccount: "A", ToAccount: "B", Amount: 1}, transfer)
+	assertfatal.EqualError(err, nil, t)
+
+	t.Run("Should not collide with key of another tenant", func(t *testing.T) {
+		result2, err := wrapper.Wrap(tenant2Ctx, idempotencyKey,
+			transferInput{FromAccount: "B", ToAccount: "A", Amount: 2}, transfer)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(result1 == result2, false, t)
+	})
+
+	t.Run("Should list and purge records by scope", func(t *testing.T) {
+		tx := db.Txn(true)
+		defer tx.Abort()
+		store := uow.NewIdempotencyStore(tx).(idempo.ScopedStore)
+		records, err := store.List(context.TODO(), "transfer/tenant-1")
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(len(records), 1, t)
+		assertfatal.Equal(records[0].ID, "transfer/tenant-1#transfer-123", t)
+
+		err = store.Purge(context.TODO(), "transfer/tenant-1")
+		assertfatal.EqualError(err, nil, t)
+		records, err = store.List(context.TODO(), "transfer/tenant-1")
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(len(records), 0, t)
+	})
+}
+
+type tenantKey struct{}
+
+func TestKeyValidator(t *testing.T) {
+	conf := newConf(newUnitOfWork(newDB()))
+	conf.KeyValidator = idempo.KeyValidators(
+		idempo.NonEmptyKey(),
+		idempo.MaxKeyLength(36),
+		idempo.UUIDKey(),
+	)
+	var (
+		wrapper = idempo.NewWrapper[repos, transferInput](conf)
+		input   = transferInput{FromAccount: "A", ToAccount: "B", Amount: 1}
+	)
+	for _, idempotencyKey := range []string{"", "transfer-123"} {
+		_, err := wrapper.Wrap(context.TODO(), idempotencyKey, input, transfer)
+		assertfatal.Equal(errors.Is(err, idempo.ErrInvalidIdempotencyKey), true, t)
+	}
+	_, err := wrapper.Wrap(context.TODO(), uuid.NewString(), input, transfer)
+	assertfatal.EqualError(err, nil, t)
+}
+
+func TestWrapIn(t *testing.T) {
+	var (
+		db         = newDB()
+		unitOfWork = newUnitOfWork(db)
+		wrapper    = idempo.NewWrapper[repos, transferInput](newConf(unitOfWork))
+		transfers  = func(input1, input2 transferInput) error {
+			return unitOfWork.Execute(func(repos repos) (err error) {
+				_, err = wrapper.WrapIn(context.TODO(), repos, "transfer-1", input1,
+					transfer)
+				if err != nil {
+					return
+				}
+				_, err = wrapper.WrapIn(context.TODO(), repos, "transfer-2", input2,
+					transfer)
+				return
+			})
+		}
+	)
+
+	t.Run("Should roll back both transfers if one fails", func(t *testing.T) {
+		err := transfers(
+			transferInput{FromAccount: "A", ToAccount: "B", Amount: 500},
+			transferInput{FromAccount: "A", ToAccount: "B", Amount: 600},
+		)
+		assertfatal.EqualError(err, errInsufficientFunds, t)
+		assertfatal.Equal(getBalance(db, "A"), 1000, t)
+		assertfatal.Equal(getBalance(db, "B"), 1000, t)
+	})
+
+	t.Run("Should commit both transfers together", func(t *testing.T) {
+		err := transfers(
+			transferInput{FromAccount: "A", ToAccount: "B", Amount: 500},
+			transferInput{FromAccount: "B", ToAccount: "A", Amount: 200},
+		)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(getBalance(db, "A"), 700, t)
+		assertfatal.Equal(getBalance(db, "B"), 1300, t)
+		assertfatal.Equal(getRecord(db, "transfer-1").SuccessOutput, true, t)
+		assertfatal.Equal(getRecord(db, "transfer-2").SuccessOutput, true, t)
+	})
+
+	t.Run("Should replay both transfers", func(t *testing.T) {
+		err := transfers(
+			transferInput{FromAccount: "A", ToAccount: "B", Amount: 500},
+			transferInput{FromAccount: "B", ToAccount: "A", Amount: 200},
+		)
+		assertfatal.EqualError(err, nil, t)
+		assertfatal.Equal(getBalance(db, "A"), 700, t)
+		assertfatal.Equal(getBalance(db, "B"), 1300, t)
+	})
+}